@@ -183,6 +183,32 @@ func (l *LCD) PrintUint8(u uint8) {
 	l.Print(strconv.Itoa(int(u)))
 }
 
+// print2 prints a number on two digits
+func (l *LCD) print2(n int) {
+	l.write(uint8('0' + n/10%10))
+	l.write(uint8('0' + n%10))
+}
+
+// PrintTime prints the time of the day (hh:mm:ss)
+func (l *LCD) PrintTime(t time.Time) {
+	hour, min, sec := t.Clock()
+	l.print2(hour)
+	l.Print(":")
+	l.print2(min)
+	l.Print(":")
+	l.print2(sec)
+}
+
+// PrintDate prints the date (yyyy-mm-dd)
+func (l *LCD) PrintDate(t time.Time) {
+	year, month, day := t.Date()
+	l.PrintInt(year)
+	l.Print("-")
+	l.print2(int(month))
+	l.Print("-")
+	l.print2(day)
+}
+
 func (l *LCD) CursorOff() {
 	l.DisplayControl &= 255 - LCD_CURSORON
 	l.command(LCD_DISPLAYCONTROL | l.DisplayControl)
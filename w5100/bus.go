@@ -0,0 +1,17 @@
+package w5100
+
+// Bus is the hardware interface used to talk to the W5100 chip
+//
+// The W5100 only needs a full-duplex byte transfer and a way
+// to assert/release its chip select (SS) line. The AVR SPI
+// peripheral, any tinygo machine.SPI or the software chip of the
+// emulator package can then be used as backend.
+type Bus interface {
+	// Transfer sends a single byte and returns the byte
+	// received at the same time
+	Transfer(data uint8) uint8
+	// Select asserts the chip select line (SS low)
+	Select()
+	// Deselect releases the chip select line (SS high)
+	Deselect()
+}
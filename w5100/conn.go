@@ -0,0 +1,123 @@
+package w5100
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Conn wraps a TCP socket into a net.Conn so that standard
+// io, bufio or protocol code can run on a W5100 connection
+type Conn struct {
+	sock          *Socket
+	readDeadline  time.Time
+	writeDeadline time.Time
+	listener      *Listener // re-arms the slot on Close (if accepted)
+	index         int       // slot of the listener
+}
+
+var _ net.Conn = (*Conn)(nil)
+
+// NewConn returns a net.Conn on top of a connected TCP socket
+func NewConn(sock *Socket) *Conn {
+	return &Conn{sock: sock}
+}
+
+// Socket returns the underlying socket
+func (c *Conn) Socket() *Socket {
+	return c.sock
+}
+
+// deadlineContext returns a context which expires at the deadline
+// (if set)
+func deadlineContext(deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return context.Background(), func() {}
+	}
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+// netError converts the socket errors to the ones expected
+// from a net.Conn
+func netError(err error) error {
+	switch err {
+	case context.DeadlineExceeded:
+		return ErrTimeout
+	case ErrClosed:
+		return net.ErrClosed
+	}
+	return err
+}
+
+// Read reads data from the connection. It blocks until some data
+// is received, the peer closes the connection (io.EOF) or the
+// read deadline is exceeded.
+func (c *Conn) Read(b []byte) (int, error) {
+	ctx, cancel := deadlineContext(c.readDeadline)
+	defer cancel()
+	n, err := c.sock.readContext(ctx, b)
+	return n, netError(err)
+}
+
+// Write writes data to the connection. Buffers larger than the
+// Tx memory are sent in several chunks.
+func (c *Conn) Write(b []byte) (int, error) {
+	ctx, cancel := deadlineContext(c.writeDeadline)
+	defer cancel()
+	n, err := c.sock.writeContext(ctx, b)
+	return n, netError(err)
+}
+
+// Close disconnects and closes the socket (releasing its slot). The
+// slot of a connection returned by a Listener is armed again in
+// LISTEN mode instead, as long as the listener is open.
+func (c *Conn) Close() error {
+	if !c.sock.owned() {
+		return net.ErrClosed
+	}
+	if c.sock.read(SocketRegister.SR) != Status.CLOSED {
+		c.sock.Disconnect()
+	}
+	if l := c.listener; l != nil && !l.closed {
+		return l.arm(c.index)
+	}
+	return c.sock.Close()
+}
+
+// LocalAddr returns the address of the chip and the source port
+// of the socket
+func (c *Conn) LocalAddr() net.Addr {
+	return &net.TCPAddr{
+		IP:   net.IP(c.sock.wiznet.GetIPAddress()),
+		Port: int(c.sock.read16(SocketRegister.PORT)),
+	}
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{
+		IP:   net.IP(c.sock.readBuffer(SocketRegister.DIPR, 4)),
+		Port: int(c.sock.read16(SocketRegister.DPORT)),
+	}
+}
+
+// SetDeadline sets both the read and write deadlines
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline = t
+	c.writeDeadline = t
+	return nil
+}
+
+// SetReadDeadline sets the deadline of the future Read calls
+// (zero value means no deadline)
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the future Write calls
+// (zero value means no deadline)
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,289 @@
+package dhcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+var (
+	// ErrNak is returned when the server refuses the request
+	ErrNak = errors.New("dhcp: request refused by the server (NAK)")
+	// ErrNoLease is returned when the client has no lease to renew or release
+	ErrNoLease = errors.New("dhcp: no lease")
+)
+
+// infinite is the lease time of a permanent address
+const infinite = 0xFFFFFFFF
+
+var (
+	broadcast = [4]uint8{255, 255, 255, 255}
+	zero      = [4]uint8{}
+)
+
+// Client gets and maintains the network configuration of the chip
+// (SIPR, SUBR and GWR registers) from a DHCP server
+type Client struct {
+	wiznet *w5100.W5100
+	// Hostname is sent to the server (option 12) if not empty
+	Hostname string
+	// Timeout is the time to wait for each answer of the server
+	Timeout time.Duration
+
+	mac      [6]uint8
+	xid      uint32
+	b        builder
+	lease    reply     // last acknowledged lease
+	bound    bool      // the lease is valid
+	obtained time.Time // when the lease was acknowledged
+	nextTry  time.Time // next renewal attempt
+}
+
+// NewClient returns a DHCP client for the chip. The MAC address must
+// already be set.
+func NewClient(w *w5100.W5100) *Client {
+	c := &Client{wiznet: w, Timeout: 4 * time.Second}
+	copy(c.mac[:], w.GetMACAddress())
+	// the transaction id only needs to differ between clients
+	c.xid = uint32(c.mac[2])<<24 | uint32(c.mac[3])<<16 | uint32(c.mac[4])<<8 | uint32(c.mac[5])
+	c.xid ^= uint32(time.Now().UnixNano())
+	return c
+}
+
+// IP returns the leased address
+func (c *Client) IP() []uint8 {
+	return c.lease.yiaddr[:]
+}
+
+// SubnetMask returns the subnet mask given by the server
+func (c *Client) SubnetMask() []uint8 {
+	return c.lease.mask[:]
+}
+
+// Gateway returns the router given by the server
+func (c *Client) Gateway() []uint8 {
+	return c.lease.router[:]
+}
+
+// DNS returns the (first) DNS server given by the server
+func (c *Client) DNS() []uint8 {
+	return c.lease.dns[:]
+}
+
+// Config returns the network configuration given by the server
+func (c *Client) Config() w5100.NetConfig {
+	cfg := w5100.NetConfig{MAC: net.HardwareAddr(c.mac[:])}
+	ones, _ := net.IPMask(c.lease.mask[:]).Size()
+	cfg.Address = netip.PrefixFrom(netip.AddrFrom4(c.lease.yiaddr), ones)
+	if c.lease.router != zero {
+		cfg.Gateway = netip.AddrFrom4(c.lease.router)
+	}
+	if c.lease.dns != zero {
+		cfg.DNS = netip.AddrFrom4(c.lease.dns)
+	}
+	return cfg
+}
+
+// LeaseTime returns the duration of the lease
+func (c *Client) LeaseTime() time.Duration {
+	return seconds(c.lease.lease)
+}
+
+// Bound tells whether the client holds a valid lease
+func (c *Client) Bound() bool {
+	return c.bound && !c.expired(c.lease.lease)
+}
+
+func seconds(s uint32) time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+// expired tells whether the given delay (in seconds) since
+// the lease was obtained is over
+func (c *Client) expired(delay uint32) bool {
+	if c.lease.lease == infinite {
+		return false
+	}
+	return time.Since(c.obtained) >= seconds(delay)
+}
+
+// Request runs the whole DISCOVER/OFFER/REQUEST/ACK exchange and
+// configures the chip with the lease. It retries until the context
+// is done.
+func (c *Client) Request(ctx context.Context) error {
+	c.bound = false
+	c.wiznet.SetIPAddress(zero[:])
+
+	sock, err := c.wiznet.Open(w5100.Mode.UDP, ClientPort, 0)
+	if err != nil {
+		return err
+	}
+	defer sock.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.xid++
+
+		c.b.start(msgDiscover, c.xid, c.mac, zero, true)
+		c.options()
+		offer, err := c.exchange(ctx, sock, broadcast, c.b.end(), msgOffer)
+		if err == w5100.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		c.b.start(msgRequest, c.xid, c.mac, zero, true)
+		c.b.option(optRequestedIP, offer.yiaddr[:]...)
+		c.b.option(optServerID, offer.serverID[:]...)
+		c.options()
+		ack, err := c.exchange(ctx, sock, broadcast, c.b.end(), msgAck)
+		if err == w5100.ErrTimeout || err == ErrNak {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c.bind(ack)
+		return nil
+	}
+}
+
+// Maintain renews the lease when needed. It must be called
+// regularly from the main loop: the lease is renewed with the
+// server after T1, with any server after T2 and a new one is
+// requested when it has expired or when the server refuses to
+// extend it (NAK).
+func (c *Client) Maintain(ctx context.Context) error {
+	if !c.bound {
+		return ErrNoLease
+	}
+	if c.expired(c.lease.lease) {
+		return c.Request(ctx)
+	}
+	if !c.expired(c.lease.t1) || time.Now().Before(c.nextTry) {
+		return nil
+	}
+
+	sock, err := c.wiznet.Open(w5100.Mode.UDP, ClientPort, 0)
+	if err != nil {
+		return err
+	}
+
+	// renewing (unicast to our server) or rebinding (broadcast)
+	dst := c.lease.serverID
+	if c.expired(c.lease.t2) {
+		dst = broadcast
+	}
+	c.xid++
+	c.b.start(msgRequest, c.xid, c.mac, c.lease.yiaddr, false)
+	c.options()
+	ack, err := c.exchange(ctx, sock, dst, c.b.end(), msgAck)
+	sock.Close()
+	if err == ErrNak {
+		// the address cannot be used anymore (RFC 2131 4.4.5): drop
+		// the lease and the address, then start from the discovery
+		c.lease = reply{}
+		return c.Request(ctx)
+	}
+	if err != nil {
+		// try again later (but before the lease expires)
+		remaining := seconds(c.lease.lease) - time.Since(c.obtained)
+		wait := remaining / 2
+		if wait > time.Minute {
+			wait = time.Minute
+		}
+		c.nextTry = time.Now().Add(wait)
+		return err
+	}
+	c.bind(ack)
+	return nil
+}
+
+// Release gives the address back to the server
+func (c *Client) Release() error {
+	if !c.bound {
+		return ErrNoLease
+	}
+	sock, err := c.wiznet.Open(w5100.Mode.UDP, ClientPort, 0)
+	if err != nil {
+		return err
+	}
+	defer sock.Close()
+
+	c.xid++
+	c.b.start(msgRelease, c.xid, c.mac, c.lease.yiaddr, false)
+	c.b.option(optServerID, c.lease.serverID[:]...)
+	_, err = sock.SendTo(c.lease.serverID[:], ServerPort, c.b.end())
+	c.bound = false
+	c.wiznet.SetIPAddress(zero[:])
+	return err
+}
+
+// options appends the options shared by DISCOVER and REQUEST
+func (c *Client) options() {
+	c.b.option(optClientID, 1, c.mac[0], c.mac[1], c.mac[2], c.mac[3], c.mac[4], c.mac[5])
+	if c.Hostname != "" {
+		c.b.option(optHostname, []uint8(c.Hostname)...)
+	}
+	c.b.option(optParamRequest, optSubnetMask, optRouter, optDNS, optLeaseTime, optT1, optT2)
+}
+
+// exchange sends the message and waits for an answer of the given type
+func (c *Client) exchange(ctx context.Context, sock *w5100.Socket, dst [4]uint8, msg []uint8, want uint8) (reply, error) {
+	if _, err := sock.SendToContext(ctx, dst[:], ServerPort, msg); err != nil {
+		return reply{}, err
+	}
+
+	deadline := time.Now().Add(c.Timeout)
+	for time.Now().Before(deadline) {
+		if err := ctx.Err(); err != nil {
+			return reply{}, err
+		}
+		data, _, port := sock.RecvFrom()
+		if data == nil || port != ServerPort {
+			continue
+		}
+		r, ok := parse(data, c.xid, c.mac)
+		if !ok {
+			continue
+		}
+		switch r.msgType {
+		case want:
+			return r, nil
+		case msgNak:
+			return r, ErrNak
+		}
+	}
+	return reply{}, w5100.ErrTimeout
+}
+
+// bind stores the lease and configures the chip
+func (c *Client) bind(ack reply) {
+	if ack.lease == 0 {
+		ack.lease = infinite
+	}
+	if ack.lease != infinite {
+		if ack.t1 == 0 || ack.t1 >= ack.lease {
+			ack.t1 = ack.lease / 2
+		}
+		if ack.t2 == 0 || ack.t2 >= ack.lease || ack.t2 < ack.t1 {
+			ack.t2 = ack.lease / 8 * 7
+		}
+	}
+	c.lease = ack
+	c.bound = true
+	c.obtained = time.Now()
+	c.nextTry = time.Time{}
+
+	c.wiznet.SetIPAddress(ack.yiaddr[:])
+	c.wiznet.SetSubnetMask(ack.mask[:])
+	c.wiznet.SetGatewayIP(ack.router[:])
+}
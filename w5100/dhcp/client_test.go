@@ -0,0 +1,380 @@
+package dhcp
+
+import (
+	"context"
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+var (
+	testMAC    = [6]uint8{0xDE, 0xAD, 0xBE, 0xEF, 0xFE, 0xED}
+	testServer = [4]uint8{10, 0, 0, 1}
+)
+
+// message builds a server message for the transaction
+func message(msgType uint8, xid uint32, mac [6]uint8, yiaddr [4]uint8, options ...[]uint8) []uint8 {
+	b := make([]uint8, offOptions)
+	b[0] = opReply
+	binary.BigEndian.PutUint32(b[offXid:], xid)
+	copy(b[offYiaddr:], yiaddr[:])
+	copy(b[offChaddr:], mac[:])
+	copy(b[offCookie:], magicCookie[:])
+	b = append(b, optMessageType, 1, msgType)
+	for _, o := range options {
+		b = append(b, o...)
+	}
+	return append(b, optEnd)
+}
+
+// opt encodes an option
+func opt(code uint8, value ...uint8) []uint8 {
+	return append([]uint8{code, uint8(len(value))}, value...)
+}
+
+// seconds32 encodes a time option
+func seconds32(code uint8, s uint32) []uint8 {
+	return opt(code, binary.BigEndian.AppendUint32(nil, s)...)
+}
+
+func TestParse(t *testing.T) {
+	const xid = 0x01020304
+	yiaddr := [4]uint8{10, 0, 0, 50}
+	r, ok := parse(message(msgAck, xid, testMAC, yiaddr,
+		[]uint8{optPad, optPad},
+		opt(optSubnetMask, 255, 255, 255, 0),
+		opt(optRouter, 10, 0, 0, 1, 10, 0, 0, 2),
+		opt(optDNS, 10, 0, 0, 53),
+		opt(optServerID, testServer[:]...),
+		seconds32(optLeaseTime, 3600),
+		seconds32(optT1, 1000),
+		seconds32(optT2, 2000),
+		opt(optHostname, 'x'),
+	), xid, testMAC)
+	want := reply{
+		msgType:  msgAck,
+		yiaddr:   yiaddr,
+		mask:     [4]uint8{255, 255, 255, 0},
+		router:   [4]uint8{10, 0, 0, 1},
+		dns:      [4]uint8{10, 0, 0, 53},
+		serverID: testServer,
+		lease:    3600,
+		t1:       1000,
+		t2:       2000,
+	}
+	if !ok || r != want {
+		t.Errorf("parse: %+v, %t", r, ok)
+	}
+
+	// the options after the end are ignored
+	msg := message(msgOffer, xid, testMAC, yiaddr)
+	msg = append(msg, optSubnetMask, 10)
+	if r, ok := parse(msg, xid, testMAC); !ok || r.msgType != msgOffer || r.mask != zero {
+		t.Errorf("options after the end: %+v, %t", r, ok)
+	}
+
+	otherMAC := testMAC
+	otherMAC[5]++
+	request := message(msgAck, xid, testMAC, yiaddr)
+	request[0] = opRequest
+	cookie := message(msgAck, xid, testMAC, yiaddr)
+	cookie[offCookie]++
+	for _, tc := range []struct {
+		name string
+		msg  []uint8
+	}{
+		{"short", message(msgAck, xid, testMAC, yiaddr)[:offOptions-1]},
+		{"request", request},
+		{"other transaction", message(msgAck, xid+1, testMAC, yiaddr)},
+		{"other client", message(msgAck, xid, otherMAC, yiaddr)},
+		{"magic cookie", cookie},
+		{"no type", message(msgAck, xid, testMAC, yiaddr)[:offOptions]},
+		{"type of 2 bytes", append(message(msgAck, xid, testMAC, yiaddr)[:offOptions], optMessageType, 2, msgAck, 0, optEnd)},
+		{"truncated option", message(msgAck, xid, testMAC, yiaddr, []uint8{optDNS, 4, 10, 0})[:offOptions+7]},
+		{"truncated length", append(message(msgAck, xid, testMAC, yiaddr)[:offOptions+3], optDNS)},
+	} {
+		if r, ok := parse(tc.msg, xid, testMAC); ok {
+			t.Errorf("%s: accepted %+v", tc.name, r)
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		lease, t1, t2       uint32
+		wantLease, wt1, wt2 uint32
+	}{
+		{"given", 3600, 1000, 2000, 3600, 1000, 2000},
+		{"missing", 3600, 0, 0, 3600, 1800, 3150},
+		{"beyond the lease", 3600, 3600, 4000, 3600, 1800, 3150},
+		{"t2 before t1", 3600, 1000, 500, 3600, 1000, 3150},
+		{"no lease time", 0, 0, 0, infinite, 0, 0},
+		{"infinite", infinite, 0, 0, infinite, 0, 0},
+	} {
+		c := NewClient(w5100.New(emulator.New()))
+		c.bind(reply{msgType: msgAck, lease: tc.lease, t1: tc.t1, t2: tc.t2})
+		if l := c.lease; l.lease != tc.wantLease || l.t1 != tc.wt1 || l.t2 != tc.wt2 {
+			t.Errorf("%s: lease %d, T1 %d, T2 %d", tc.name, l.lease, l.t1, l.t2)
+		}
+		if !c.Bound() {
+			t.Errorf("%s: not bound", tc.name)
+		}
+	}
+}
+
+// request is a message received by the server stand-in
+type request struct {
+	msgType uint8
+	dst     [4]uint8
+	ciaddr  [4]uint8
+	ip      []uint8 // requested address (option 50)
+}
+
+// server is a stand-in for a DHCP server. It answers the messages
+// of the client with the message type returned by answer (0 for no
+// answer) and leases the address next.
+type server struct {
+	chip   *emulator.Chip
+	answer func(request) uint8
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu       sync.Mutex
+	next     [4]uint8
+	requests []request
+}
+
+func newServer(t *testing.T, chip *emulator.Chip, answer func(request) uint8) *server {
+	s := &server{
+		chip:   chip,
+		answer: answer,
+		next:   [4]uint8{10, 0, 0, 50},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	t.Cleanup(func() {
+		close(s.stop)
+		<-s.done
+	})
+	return s
+}
+
+// option returns the value of the option of a client message
+func option(msg []uint8, code uint8) []uint8 {
+	opts := msg[offOptions:]
+	for len(opts) > 2 && opts[0] != optEnd {
+		if opts[0] == code {
+			return opts[2 : 2+int(opts[1])]
+		}
+		opts = opts[2+int(opts[1]):]
+	}
+	return nil
+}
+
+func (s *server) run() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		for id := 0; id < w5100.MaxSockNum; id++ {
+			for _, p := range s.chip.Sent(id) {
+				if p.Port != ServerPort || len(p.Data) < offOptions {
+					continue
+				}
+				r := request{msgType: option(p.Data, optMessageType)[0], dst: p.IP, ip: option(p.Data, optRequestedIP)}
+				copy(r.ciaddr[:], p.Data[offCiaddr:])
+				s.mu.Lock()
+				s.requests = append(s.requests, r)
+				yiaddr := s.next
+				s.mu.Unlock()
+
+				typ := s.answer(r)
+				if typ == 0 {
+					continue
+				}
+				var mac [6]uint8
+				copy(mac[:], p.Data[offChaddr:])
+				msg := message(typ, binary.BigEndian.Uint32(p.Data[offXid:]), mac, yiaddr,
+					opt(optSubnetMask, 255, 255, 255, 0),
+					opt(optRouter, 10, 0, 0, 1),
+					opt(optDNS, 10, 0, 0, 53),
+					opt(optServerID, testServer[:]...),
+					seconds32(optLeaseTime, 3600),
+				)
+				s.chip.DeliverDatagram(id, testServer, ServerPort, msg)
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// received returns the messages received so far
+func (s *server) received() []request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]request(nil), s.requests...)
+}
+
+// lease changes the address given by the next answers
+func (s *server) lease(ip [4]uint8) {
+	s.mu.Lock()
+	s.next = ip
+	s.mu.Unlock()
+}
+
+// standard answers DISCOVER with OFFER and REQUEST with ACK
+func standard(r request) uint8 {
+	switch r.msgType {
+	case msgDiscover:
+		return msgOffer
+	case msgRequest:
+		return msgAck
+	}
+	return 0
+}
+
+// newBound returns a client bound by the server stand-in
+func newBound(t *testing.T, answer func(request) uint8) (*Client, *w5100.W5100, *server) {
+	t.Helper()
+	chip := emulator.New()
+	w := w5100.New(chip)
+	w.SetMACAddress(testMAC[:])
+	s := newServer(t, chip, answer)
+	c := NewClient(w)
+	c.Timeout = 200 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Request(ctx); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	return c, w, s
+}
+
+func TestRequest(t *testing.T) {
+	c, w, s := newBound(t, standard)
+	got := s.received()
+	if len(got) != 2 || got[0].msgType != msgDiscover || got[1].msgType != msgRequest {
+		t.Fatalf("received %+v", got)
+	}
+	if got[0].dst != broadcast || string(got[1].ip) != string([]uint8{10, 0, 0, 50}) {
+		t.Errorf("REQUEST %+v", got[1])
+	}
+	if !c.Bound() || c.LeaseTime() != time.Hour {
+		t.Errorf("bound %t for %v", c.Bound(), c.LeaseTime())
+	}
+	if cfg := c.Config().String(); cfg != "ip=10.0.0.50/24 gw=10.0.0.1 mac=de:ad:be:ef:fe:ed dns=10.0.0.53" {
+		t.Errorf("config %s", cfg)
+	}
+	if ip := w.GetIPAddress(); string(ip) != string([]uint8{10, 0, 0, 50}) {
+		t.Errorf("chip address %v", ip)
+	}
+}
+
+func TestRequestNak(t *testing.T) {
+	naks := 1
+	_, _, s := newBound(t, func(r request) uint8 {
+		if r.msgType == msgRequest && naks > 0 {
+			naks--
+			return msgNak
+		}
+		return standard(r)
+	})
+	var types []uint8
+	for _, r := range s.received() {
+		types = append(types, r.msgType)
+	}
+	if string(types) != string([]uint8{msgDiscover, msgRequest, msgDiscover, msgRequest}) {
+		t.Errorf("messages %v", types)
+	}
+}
+
+func TestMaintain(t *testing.T) {
+	ctx := context.Background()
+	c, _, s := newBound(t, standard)
+	if err := c.Maintain(ctx); err != nil || len(s.received()) != 2 {
+		t.Fatalf("Maintain before T1: %v, %+v", err, s.received())
+	}
+
+	// renewing: unicast to the server
+	c.obtained = time.Now().Add(-seconds(c.lease.t1))
+	if err := c.Maintain(ctx); err != nil {
+		t.Fatalf("renewing: %v", err)
+	}
+	r := s.received()[2]
+	if r.msgType != msgRequest || r.dst != testServer || r.ciaddr != [4]uint8{10, 0, 0, 50} {
+		t.Errorf("renewing %+v", r)
+	}
+	if time.Since(c.obtained) > time.Second {
+		t.Error("the lease is not extended")
+	}
+
+	// rebinding: broadcast
+	c.obtained = time.Now().Add(-seconds(c.lease.t2))
+	if err := c.Maintain(ctx); err != nil {
+		t.Fatalf("rebinding: %v", err)
+	}
+	if r := s.received()[3]; r.dst != broadcast || r.ciaddr != [4]uint8{10, 0, 0, 50} {
+		t.Errorf("rebinding %+v", r)
+	}
+}
+
+func TestMaintainNak(t *testing.T) {
+	ctx := context.Background()
+	c, w, s := newBound(t, func(r request) uint8 {
+		if r.msgType == msgRequest && r.ciaddr != zero {
+			// the renewal is refused
+			return msgNak
+		}
+		return standard(r)
+	})
+	s.lease([4]uint8{10, 0, 0, 60})
+	c.obtained = time.Now().Add(-seconds(c.lease.t1))
+	if err := c.Maintain(ctx); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+	var types []uint8
+	for _, r := range s.received() {
+		types = append(types, r.msgType)
+	}
+	if string(types) != string([]uint8{msgDiscover, msgRequest, msgRequest, msgDiscover, msgRequest}) {
+		t.Errorf("messages %v", types)
+	}
+	if !c.Bound() || string(w.GetIPAddress()) != string([]uint8{10, 0, 0, 60}) {
+		t.Errorf("bound %t to %v", c.Bound(), w.GetIPAddress())
+	}
+}
+
+func TestMaintainTimeout(t *testing.T) {
+	ctx := context.Background()
+	c, _, s := newBound(t, func(r request) uint8 {
+		if r.ciaddr != zero {
+			// the server does not answer the renewals
+			return 0
+		}
+		return standard(r)
+	})
+	c.obtained = time.Now().Add(-seconds(c.lease.t1))
+	if err := c.Maintain(ctx); err != w5100.ErrTimeout {
+		t.Fatalf("Maintain: %v", err)
+	}
+	// the next attempt waits a minute at most
+	if wait := time.Until(c.nextTry); wait <= 0 || wait > time.Minute {
+		t.Errorf("next try in %v", wait)
+	}
+	if err := c.Maintain(ctx); err != nil || len(s.received()) != 3 {
+		t.Errorf("retried at once: %v, %+v", err, s.received())
+	}
+	if !c.Bound() {
+		t.Error("lease dropped")
+	}
+}
@@ -0,0 +1,17 @@
+// Package dhcp configures the W5100 from a DHCP server
+//
+// # Examples
+//
+// The MAC address must be set before requesting a lease
+//
+//	w.SetMACAddress([]uint8{0x00, 0x08, 0xDC, 0xAF, 0xEE, 0x00})
+//	client := dhcp.NewClient(w)
+//	err := client.Request(context.Background())
+//
+// Then the lease is renewed from the main loop
+//
+//	for {
+//		client.Maintain(context.Background())
+//		// ...
+//	}
+package dhcp
@@ -0,0 +1,186 @@
+package dhcp
+
+import "encoding/binary"
+
+// DHCP ports
+const (
+	ServerPort uint16 = 67
+	ClientPort uint16 = 68
+)
+
+// BOOTP operations
+const (
+	opRequest uint8 = 1
+	opReply   uint8 = 2
+)
+
+// Message types (option 53)
+const (
+	msgDiscover uint8 = 1
+	msgOffer    uint8 = 2
+	msgRequest  uint8 = 3
+	msgDecline  uint8 = 4
+	msgAck      uint8 = 5
+	msgNak      uint8 = 6
+	msgRelease  uint8 = 7
+)
+
+// Options
+const (
+	optPad          uint8 = 0
+	optSubnetMask   uint8 = 1
+	optRouter       uint8 = 3
+	optDNS          uint8 = 6
+	optHostname     uint8 = 12
+	optRequestedIP  uint8 = 50
+	optLeaseTime    uint8 = 51
+	optMessageType  uint8 = 53
+	optServerID     uint8 = 54
+	optParamRequest uint8 = 55
+	optT1           uint8 = 58
+	optT2           uint8 = 59
+	optClientID     uint8 = 61
+	optEnd          uint8 = 255
+)
+
+// layout of the BOOTP header
+const (
+	offXid     = 4
+	offFlags   = 10
+	offCiaddr  = 12
+	offYiaddr  = 16
+	offChaddr  = 28
+	offCookie  = 236
+	offOptions = 240
+	// broadcast flag: the server must broadcast its reply since
+	// the chip drops unicast datagrams until it has an address
+	flagBroadcast uint16 = 0x8000
+)
+
+// maximum size of the messages built by the client
+const maxMessageSize = offOptions + 64
+
+var magicCookie = [4]uint8{99, 130, 83, 99}
+
+// builder writes a client message into a fixed buffer
+type builder struct {
+	buf [maxMessageSize]uint8
+	n   int
+}
+
+// start writes the BOOTP header
+func (b *builder) start(msgType uint8, xid uint32, mac [6]uint8, ciaddr [4]uint8, broadcast bool) {
+	b.buf = [maxMessageSize]uint8{}
+	b.buf[0] = opRequest
+	b.buf[1] = 1 // ethernet
+	b.buf[2] = 6 // MAC length
+	binary.BigEndian.PutUint32(b.buf[offXid:], xid)
+	if broadcast {
+		binary.BigEndian.PutUint16(b.buf[offFlags:], flagBroadcast)
+	}
+	copy(b.buf[offCiaddr:], ciaddr[:])
+	copy(b.buf[offChaddr:], mac[:])
+	copy(b.buf[offCookie:], magicCookie[:])
+	b.n = offOptions
+	b.option(optMessageType, msgType)
+}
+
+// option appends an option (truncated if the buffer is full)
+func (b *builder) option(code uint8, data ...uint8) {
+	if b.n+2+len(data) > len(b.buf)-1 {
+		return
+	}
+	b.buf[b.n] = code
+	b.buf[b.n+1] = uint8(len(data))
+	b.n += 2
+	b.n += copy(b.buf[b.n:], data)
+}
+
+// end closes the option list and returns the message
+func (b *builder) end() []uint8 {
+	b.buf[b.n] = optEnd
+	b.n++
+	return b.buf[:b.n]
+}
+
+// reply is the useful content of a server message
+type reply struct {
+	msgType  uint8
+	yiaddr   [4]uint8
+	mask     [4]uint8
+	router   [4]uint8
+	dns      [4]uint8
+	serverID [4]uint8
+	lease    uint32 // seconds
+	t1       uint32 // seconds
+	t2       uint32 // seconds
+}
+
+// parse decodes a server message. It returns false if the message
+// is malformed or is not an answer to the given transaction.
+func parse(data []uint8, xid uint32, mac [6]uint8) (reply, bool) {
+	var r reply
+	if len(data) < offOptions || data[0] != opReply {
+		return r, false
+	}
+	if binary.BigEndian.Uint32(data[offXid:]) != xid {
+		return r, false
+	}
+	for i, b := range mac {
+		if data[offChaddr+i] != b {
+			return r, false
+		}
+	}
+	for i, b := range magicCookie {
+		if data[offCookie+i] != b {
+			return r, false
+		}
+	}
+	copy(r.yiaddr[:], data[offYiaddr:])
+
+	opts := data[offOptions:]
+	for len(opts) > 0 {
+		code := opts[0]
+		if code == optEnd {
+			break
+		}
+		if code == optPad {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return r, false
+		}
+		value := opts[2 : 2+int(opts[1])]
+		opts = opts[2+int(opts[1]):]
+
+		switch code {
+		case optMessageType:
+			if len(value) == 1 {
+				r.msgType = value[0]
+			}
+		case optSubnetMask:
+			copy(r.mask[:], value)
+		case optRouter:
+			copy(r.router[:], value)
+		case optDNS:
+			copy(r.dns[:], value)
+		case optServerID:
+			copy(r.serverID[:], value)
+		case optLeaseTime:
+			r.lease = uint32Option(value)
+		case optT1:
+			r.t1 = uint32Option(value)
+		case optT2:
+			r.t2 = uint32Option(value)
+		}
+	}
+	return r, r.msgType != 0
+}
+
+func uint32Option(value []uint8) uint32 {
+	if len(value) != 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(value)
+}
@@ -0,0 +1,347 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+// encodeName encodes the name as a list of labels
+func encodeName(name string) []uint8 {
+	var b []uint8
+	for _, label := range strings.Split(name, ".") {
+		b = append(b, uint8(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// answer encodes a resource record of class IN
+func answer(name []uint8, rtype uint16, ttl uint32, data []uint8) []uint8 {
+	b := append([]uint8(nil), name...)
+	b = binary.BigEndian.AppendUint16(b, rtype)
+	b = binary.BigEndian.AppendUint16(b, classIN)
+	b = binary.BigEndian.AppendUint32(b, ttl)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// response encodes a response to the query of the name. The question
+// name is at offset 12 (pointer 0xC00C).
+func response(id, flags uint16, name string, answers ...[]uint8) []uint8 {
+	b := binary.BigEndian.AppendUint16(nil, id)
+	b = binary.BigEndian.AppendUint16(b, flagQR|flags)
+	b = append(b, 0, 1, 0, uint8(len(answers)), 0, 0, 0, 0)
+	b = append(b, encodeName(name)...)
+	b = append(b, 0, 1, 0, 1)
+	for _, a := range answers {
+		b = append(b, a...)
+	}
+	return b
+}
+
+// question is the pointer to the question name
+var question = []uint8{0xC0, 0x0C}
+
+func TestBuildQuery(t *testing.T) {
+	var buf [queryBufferSize]uint8
+	msg, err := buildQuery(buf[:], 0x1234, "www.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]uint8{0x12, 0x34, 0x01, 0, 0, 1, 0, 0, 0, 0, 0, 0}, encodeName("www.example.com")...)
+	if string(msg) != string(append(want, 0, 1, 0, 1)) {
+		t.Errorf("query %x", msg)
+	}
+	for _, name := range []string{"", ".", "a..b", strings.Repeat("a", 64), strings.Repeat("abc.", 64)} {
+		if _, err := buildQuery(buf[:], 1, name); err != ErrInvalidName {
+			t.Errorf("%q: got %v", name, err)
+		}
+	}
+}
+
+func TestReadName(t *testing.T) {
+	header := make([]uint8, headerSize)
+	msg := func(parts ...[]uint8) []uint8 {
+		b := append([]uint8(nil), header...)
+		for _, p := range parts {
+			b = append(b, p...)
+		}
+		return b
+	}
+	// a label of 63 bytes repeated past 255 bytes
+	long := []uint8{}
+	for i := 0; i < 5; i++ {
+		long = append(long, 63)
+		long = append(long, strings.Repeat("a", 63)...)
+	}
+	loop := make([]uint8, 0, 2*maxPointers+2)
+	for i := 0; i <= maxPointers; i++ {
+		// every pointer refers to the next one
+		loop = append(loop, 0xC0, uint8(headerSize+2*i+2))
+	}
+	loop = append(loop, 0)
+
+	for _, tc := range []struct {
+		name   string
+		msg    []uint8
+		offset int
+		want   string
+		next   int
+		err    error
+	}{
+		{"labels", msg(encodeName("www.example.com")), 12, "www.example.com", 29, nil},
+		{"root", msg([]uint8{0}), 12, "", 13, nil},
+		{"pointer", msg(encodeName("example.com"), []uint8{3, 'w', 'w', 'w', 0xC0, 0x0C}), 25, "www.example.com", 31, nil},
+		{"pointer to a pointer", msg(encodeName("com"), []uint8{0xC0, 0x0C, 0xC0, 0x11}), 19, "com", 21, nil},
+		{"self loop", msg(question), 12, "", 0, ErrFormat},
+		{"two pointers loop", msg([]uint8{0xC0, 0x0E, 0xC0, 0x0C}), 12, "", 0, ErrFormat},
+		{"too many pointers", msg(loop), 12, "", 0, ErrFormat},
+		{"pointer past the end", msg([]uint8{0xC0, 0xFF}), 12, "", 0, ErrFormat},
+		{"cut pointer", msg([]uint8{0xC0}), 12, "", 0, ErrFormat},
+		{"cut label", msg([]uint8{5, 'a', 'b'}), 12, "", 0, ErrFormat},
+		{"no terminator", msg([]uint8{1, 'a'}), 12, "", 0, ErrFormat},
+		{"reserved bits", msg([]uint8{0x40, 0}), 12, "", 0, ErrFormat},
+		{"too long", msg(long, []uint8{0}), 12, "", 0, ErrFormat},
+	} {
+		name, next, err := readName(tc.msg, tc.offset)
+		if name != tc.want || next != tc.next || err != tc.err {
+			t.Errorf("%s: got %q, %d, %v", tc.name, name, next, err)
+		}
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	ip := []uint8{93, 184, 216, 34}
+	valid := response(7, 0, "www.example.com",
+		answer(question, typeCNAME, 300, append([]uint8{3, 'c', 'd', 'n'}, 0xC0, 0x10)),
+		answer(encodeName("cdn.example.com"), typeA, 60, ip),
+	)
+	records, err := parseResponse(valid, 7)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("valid response: %v, %v", records, err)
+	}
+	if r := records[0]; r.name != "www.example.com" || r.rtype != typeCNAME || r.cname != "cdn.example.com" || r.ttl != 300 {
+		t.Errorf("CNAME %+v", r)
+	}
+	if r := records[1]; r.name != "cdn.example.com" || r.ip != [4]uint8(ip) || r.ttl != 60 {
+		t.Errorf("A %+v", r)
+	}
+
+	// the other classes and types are skipped
+	other := answer(question, typeA, 60, ip)
+	binary.BigEndian.PutUint16(other[4:], 3) // CH
+	records, err = parseResponse(response(7, 0, "x", other, answer(question, 28, 60, make([]uint8, 16))), 7)
+	if err != nil || len(records) != 0 {
+		t.Errorf("skipped records: %v, %v", records, err)
+	}
+
+	notQR := response(7, 0, "x")
+	notQR[2] &^= 0x80
+	// ancount larger than the message
+	tooMany := response(7, 0, "x", answer(question, typeA, 60, ip))
+	tooMany[6], tooMany[7] = 0xFF, 0xFF
+	cutRecord := response(7, 0, "x", answer(question, typeA, 60, ip))
+	badA := response(7, 0, "x", answer(question, typeA, 60, ip[:3]))
+	overflow := response(7, 0, "x", answer(question, typeA, 60, ip))
+	overflow[len(overflow)-5]++ // rdlength
+	for _, tc := range []struct {
+		name string
+		msg  []uint8
+		err  error
+	}{
+		{"short", valid[:headerSize-1], ErrFormat},
+		{"wrong id", response(8, 0, "x"), ErrFormat},
+		{"query", notQR, ErrFormat},
+		{"NXDOMAIN", response(7, rcodeNXDomain, "x"), ErrNotFound},
+		{"SERVFAIL", response(7, 2, "x"), ErrServer},
+		{"truncated", response(7, flagTC, "x"), ErrTruncated},
+		{"cut question", valid[:headerSize+3], ErrFormat},
+		{"ancount", tooMany, ErrFormat},
+		{"cut record", cutRecord[:len(cutRecord)-6], ErrFormat},
+		{"rdata past the end", overflow, ErrFormat},
+		{"short A", badA, ErrFormat},
+	} {
+		if records, err := parseResponse(tc.msg, 7); err != tc.err {
+			t.Errorf("%s: got %v, %v", tc.name, records, err)
+		}
+	}
+	// the records are not allocated for the count of the header
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	parseResponse(tooMany, 7)
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1024 {
+		t.Errorf("ancount: %d bytes allocated", n)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	records := []record{
+		{name: "www.example.com", rtype: typeCNAME, ttl: 300, cname: "a.example.net"},
+		{name: "other", rtype: typeA, ttl: 1, ip: [4]uint8{9, 9, 9, 9}},
+		{name: "b.example.org", rtype: typeA, ttl: 200, ip: [4]uint8{1, 2, 3, 4}},
+		{name: "A.example.net", rtype: typeCNAME, ttl: 100, cname: "b.example.org"},
+		{name: "loop1", rtype: typeCNAME, ttl: 5, cname: "loop2"},
+		{name: "loop2", rtype: typeCNAME, ttl: 5, cname: "loop1"},
+		{name: "alias", rtype: typeCNAME, ttl: 5, cname: "elsewhere"},
+	}
+	for _, tc := range []struct {
+		name string
+		ip   [4]uint8
+		last string
+		ttl  uint32
+		ok   bool
+	}{
+		{"www.example.com.", [4]uint8{1, 2, 3, 4}, "b.example.org", 100, true},
+		{"b.example.org", [4]uint8{1, 2, 3, 4}, "b.example.org", 200, true},
+		{"alias", [4]uint8{}, "elsewhere", 5, false},
+		{"missing", [4]uint8{}, "missing", ^uint32(0), false},
+		{"loop1", [4]uint8{}, "", 5, false},
+	} {
+		ip, last, ttl, ok := resolve(records, tc.name)
+		if ip != tc.ip || ttl != tc.ttl || ok != tc.ok || (tc.last != "" && last != tc.last) {
+			t.Errorf("%s: got %v, %q, %d, %t", tc.name, ip, last, ttl, ok)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	r := &Resolver{}
+	r.store("zero", [4]uint8{1}, 0)
+	if _, ok := r.cached("zero"); ok {
+		t.Error("a zero TTL is cached")
+	}
+	r.store("a", [4]uint8{1}, 100)
+	if ip, ok := r.cached("A"); !ok || ip != [4]uint8{1} {
+		t.Errorf("cached: %v, %t", ip, ok)
+	}
+	r.store("a", [4]uint8{2}, 100)
+	if ip, _ := r.cached("a"); ip != [4]uint8{2} || r.cache[1].name != "" {
+		t.Errorf("updated entry: %v, %+v", ip, r.cache)
+	}
+
+	// expiry
+	r.cache[0].expires = time.Now().Add(-time.Second)
+	if _, ok := r.cached("a"); ok {
+		t.Error("expired entry returned")
+	}
+
+	// the entry which expires first is replaced
+	r.Flush()
+	for i, ttl := range []uint32{300, 10, 200, 400} {
+		r.store(string(rune('a'+i)), [4]uint8{uint8(i)}, ttl)
+	}
+	r.store("e", [4]uint8{4}, 50)
+	for _, name := range []string{"a", "c", "d", "e"} {
+		if _, ok := r.cached(name); !ok {
+			t.Errorf("%s evicted", name)
+		}
+	}
+	if _, ok := r.cached("b"); ok {
+		t.Error("the entry expiring first is kept")
+	}
+}
+
+// server is a stand-in for a DNS server answering the queries sent
+// through the emulated chip
+type server struct {
+	chip    *emulator.Chip
+	ip      [4]uint8
+	answers func(name string, id uint16) []uint8
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu      sync.Mutex
+	queries []string
+}
+
+func newServer(t *testing.T, chip *emulator.Chip, answers func(string, uint16) []uint8) *server {
+	s := &server{
+		chip:    chip,
+		ip:      [4]uint8{10, 0, 0, 53},
+		answers: answers,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	t.Cleanup(func() {
+		close(s.stop)
+		<-s.done
+	})
+	return s
+}
+
+func (s *server) run() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		for id := 0; id < w5100.MaxSockNum; id++ {
+			for _, p := range s.chip.Sent(id) {
+				if p.IP != s.ip || p.Port != Port || len(p.Data) < headerSize {
+					continue
+				}
+				name, _, err := readName(p.Data, headerSize)
+				if err != nil {
+					continue
+				}
+				s.mu.Lock()
+				s.queries = append(s.queries, name)
+				s.mu.Unlock()
+				msg := s.answers(name, binary.BigEndian.Uint16(p.Data))
+				s.chip.DeliverDatagram(id, s.ip, Port, msg)
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// count returns the number of queries received
+func (s *server) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queries)
+}
+
+func TestLookupHost(t *testing.T) {
+	chip := emulator.New()
+	s := newServer(t, chip, func(name string, id uint16) []uint8 {
+		switch name {
+		case "www.example.com":
+			// the server does not follow the alias
+			return response(id, 0, name, answer(question, typeCNAME, 300, encodeName("cdn.example.net")))
+		case "cdn.example.net":
+			return response(id, 0, name, answer(question, typeA, 60, []uint8{93, 184, 216, 34}))
+		}
+		return response(id, rcodeNXDomain, name)
+	})
+	r := NewResolver(w5100.New(chip), s.ip[:])
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		ip, err := r.LookupHost(ctx, "www.example.com")
+		if err != nil || string(ip) != string([]uint8{93, 184, 216, 34}) {
+			t.Fatalf("LookupHost: %v, %v", ip, err)
+		}
+	}
+	if n := s.count(); n != 2 {
+		t.Errorf("%d queries, want 2 (then the cache)", n)
+	}
+	if _, err := r.LookupHost(ctx, "missing.example.com"); err != ErrNotFound {
+		t.Errorf("missing name: got %v", err)
+	}
+	if ip, err := r.LookupHost(ctx, "10.1.2.3"); err != nil || string(ip) != string([]uint8{10, 1, 2, 3}) || s.count() != 3 {
+		t.Errorf("dotted address: %v, %v", ip, err)
+	}
+}
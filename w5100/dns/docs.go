@@ -0,0 +1,13 @@
+// Package dns resolves host names with the W5100 UDP sockets
+//
+// # Examples
+//
+// The server can be hardcoded or given by DHCP
+//
+//	resolver := dns.NewResolver(w, client.DNS())
+//	ip, err := resolver.LookupHost(ctx, "example.com")
+//
+// Dial opens a TCP connection to a named host
+//
+//	conn, err := resolver.Dial(ctx, "api.example.com:80")
+package dns
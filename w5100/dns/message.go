@@ -0,0 +1,249 @@
+package dns
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// Port is the DNS server port
+const Port uint16 = 53
+
+// record types and class
+const (
+	typeA     uint16 = 1
+	typeCNAME uint16 = 5
+	classIN   uint16 = 1
+)
+
+// header flags
+const (
+	flagQR uint16 = 0x8000 // response
+	flagTC uint16 = 0x0200 // truncated
+	flagRD uint16 = 0x0100 // recursion desired
+	// rcodes
+	rcodeMask     uint16 = 0x000F
+	rcodeNXDomain uint16 = 3
+)
+
+const (
+	headerSize = 12
+	// maxNameSize is the maximum length of a name on the wire
+	maxNameSize = 255
+	// maxPointers bounds the compression pointers followed when
+	// decoding a name (loop protection)
+	maxPointers = 16
+	// minRecordSize is the size of the smallest resource record (root
+	// name, type, class, TTL and data length)
+	minRecordSize = 11
+)
+
+// buildQuery writes an A query for the name into buf and returns
+// the message
+func buildQuery(buf []uint8, id uint16, name string) ([]uint8, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) == 0 || len(name)+2 > maxNameSize {
+		return nil, ErrInvalidName
+	}
+	if len(buf) < headerSize+len(name)+2+4 {
+		return nil, ErrInvalidName
+	}
+
+	for i := range buf[:headerSize] {
+		buf[i] = 0
+	}
+	binary.BigEndian.PutUint16(buf[0:], id)
+	binary.BigEndian.PutUint16(buf[2:], flagRD)
+	binary.BigEndian.PutUint16(buf[4:], 1) // QDCOUNT
+	n := headerSize
+
+	for len(name) > 0 {
+		label := name
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			label, name = name[:i], name[i+1:]
+		} else {
+			name = ""
+		}
+		if len(label) == 0 || len(label) > 63 {
+			return nil, ErrInvalidName
+		}
+		buf[n] = uint8(len(label))
+		n++
+		n += copy(buf[n:], label)
+	}
+	buf[n] = 0
+	n++
+
+	binary.BigEndian.PutUint16(buf[n:], typeA)
+	binary.BigEndian.PutUint16(buf[n+2:], classIN)
+	return buf[:n+4], nil
+}
+
+// readName decodes the (possibly compressed) name at offset and
+// returns it along with the offset following it in the message
+func readName(msg []uint8, offset int) (string, int, error) {
+	var name []uint8
+	next := -1
+	pointers := 0
+	for {
+		if offset >= len(msg) {
+			return "", 0, ErrFormat
+		}
+		length := int(msg[offset])
+		switch length & 0xC0 {
+		case 0x00:
+			if length == 0 {
+				if next < 0 {
+					next = offset + 1
+				}
+				return string(name), next, nil
+			}
+			if offset+1+length > len(msg) || len(name)+length+1 > maxNameSize {
+				return "", 0, ErrFormat
+			}
+			if len(name) > 0 {
+				name = append(name, '.')
+			}
+			name = append(name, msg[offset+1:offset+1+length]...)
+			offset += 1 + length
+		case 0xC0:
+			// compression pointer
+			if offset+1 >= len(msg) || pointers >= maxPointers {
+				return "", 0, ErrFormat
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3FFF)
+			pointers++
+		default:
+			return "", 0, ErrFormat
+		}
+	}
+}
+
+// record is an answer of the response
+type record struct {
+	name  string
+	rtype uint16
+	ttl   uint32
+	ip    [4]uint8 // A record
+	cname string   // CNAME record
+}
+
+// parseResponse checks the response to the query id and returns
+// its answers
+func parseResponse(msg []uint8, id uint16) ([]record, error) {
+	if len(msg) < headerSize {
+		return nil, ErrFormat
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return nil, ErrFormat
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&flagQR == 0 {
+		return nil, ErrFormat
+	}
+	switch flags & rcodeMask {
+	case 0:
+	case rcodeNXDomain:
+		return nil, ErrNotFound
+	default:
+		return nil, ErrServer
+	}
+	if flags&flagTC != 0 {
+		return nil, ErrTruncated
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	offset := headerSize
+	for i := 0; i < qdcount; i++ {
+		_, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4 // QTYPE, QCLASS
+	}
+
+	// the count comes from the wire, the message bounds it
+	if offset > len(msg) {
+		return nil, ErrFormat
+	}
+	capacity := (len(msg) - offset) / minRecordSize
+	if ancount < capacity {
+		capacity = ancount
+	}
+	records := make([]record, 0, capacity)
+	for i := 0; i < ancount; i++ {
+		name, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, ErrFormat
+		}
+		r := record{
+			name:  name,
+			rtype: binary.BigEndian.Uint16(msg[next:]),
+			ttl:   binary.BigEndian.Uint32(msg[next+4:]),
+		}
+		class := binary.BigEndian.Uint16(msg[next+2:])
+		rdlength := int(binary.BigEndian.Uint16(msg[next+8:]))
+		rdata := next + 10
+		if rdata+rdlength > len(msg) {
+			return nil, ErrFormat
+		}
+		offset = rdata + rdlength
+
+		if class != classIN {
+			continue
+		}
+		switch r.rtype {
+		case typeA:
+			if rdlength != 4 {
+				return nil, ErrFormat
+			}
+			copy(r.ip[:], msg[rdata:])
+		case typeCNAME:
+			if r.cname, _, err = readName(msg, rdata); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// resolve follows the CNAME chain of the name among the records.
+// It returns the address (if found), the final name of the chain and
+// the lowest TTL along the chain.
+func resolve(records []record, name string) ([4]uint8, string, uint32, bool) {
+	target := strings.TrimSuffix(name, ".")
+	ttl := ^uint32(0)
+	// every record can be used once in the chain
+	for hops := 0; hops <= len(records); hops++ {
+		followed := false
+		for _, r := range records {
+			if !strings.EqualFold(r.name, target) {
+				continue
+			}
+			if r.ttl < ttl {
+				ttl = r.ttl
+			}
+			switch r.rtype {
+			case typeA:
+				return r.ip, target, ttl, true
+			case typeCNAME:
+				target = r.cname
+				followed = true
+			}
+			break
+		}
+		if !followed {
+			break
+		}
+	}
+	return [4]uint8{}, target, ttl, false
+}
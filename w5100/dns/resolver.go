@@ -0,0 +1,238 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+var (
+	// ErrNotFound is returned when the name does not exist
+	// (or has no A record)
+	ErrNotFound = errors.New("dns: host not found")
+	// ErrInvalidName is returned when the name cannot be queried
+	ErrInvalidName = errors.New("dns: invalid name")
+	// ErrFormat is returned when the response is malformed
+	ErrFormat = errors.New("dns: malformed response")
+	// ErrServer is returned when the server fails to answer
+	ErrServer = errors.New("dns: server failure")
+	// ErrTruncated is returned when the response does not fit in
+	// a datagram (TCP is not supported)
+	ErrTruncated = errors.New("dns: truncated response")
+	// ErrNoServer is returned when no server is configured
+	ErrNoServer = errors.New("dns: no server")
+)
+
+const (
+	// cacheSize is the number of names kept by the resolver
+	cacheSize = 4
+	// maxQueries bounds the queries sent to resolve a CNAME chain
+	maxQueries = 4
+	// queryBufferSize fits the header, the longest name and the question
+	queryBufferSize = headerSize + maxNameSize + 1 + 4
+)
+
+// entry is a cached address
+type entry struct {
+	name    string
+	ip      [4]uint8
+	expires time.Time
+}
+
+// Resolver is a stub resolver sending A queries to a single server
+// (e.g. the one given by DHCP) over UDP. The answers are cached
+// according to their TTL.
+type Resolver struct {
+	wiznet *w5100.W5100
+	server [4]uint8
+	// Timeout is the time to wait for each answer
+	Timeout time.Duration
+	// Retries is the number of queries sent before giving up
+	Retries int
+
+	id    uint16
+	buf   [queryBufferSize]uint8
+	cache [cacheSize]entry
+}
+
+// NewResolver returns a resolver querying the given server
+func NewResolver(w *w5100.W5100, server []uint8) *Resolver {
+	r := &Resolver{wiznet: w, Timeout: 2 * time.Second, Retries: 3}
+	r.SetServer(server)
+	r.id = uint16(time.Now().UnixNano())
+	return r
+}
+
+// SetServer changes the DNS server (e.g. after a DHCP renewal)
+func (r *Resolver) SetServer(server []uint8) {
+	copy(r.server[:], server)
+}
+
+// Server returns the DNS server
+func (r *Resolver) Server() []uint8 {
+	return r.server[:]
+}
+
+// parseIP parses a dotted IPv4 address
+func parseIP(s string) ([4]uint8, bool) {
+	var ip [4]uint8
+	for i := range ip {
+		part := s
+		if i < 3 {
+			k := strings.IndexByte(s, '.')
+			if k < 0 {
+				return ip, false
+			}
+			part, s = s[:k], s[k+1:]
+		}
+		n, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return ip, false
+		}
+		ip[i] = uint8(n)
+	}
+	return ip, true
+}
+
+// LookupHost returns the IPv4 address of the host. Dotted addresses
+// are returned as is, the names are resolved through the cache or
+// the server (following the CNAME chains).
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]uint8, error) {
+	if ip, ok := parseIP(host); ok {
+		return ip[:], nil
+	}
+	host = strings.TrimSuffix(host, ".")
+	if ip, ok := r.cached(host); ok {
+		return ip[:], nil
+	}
+	if r.server == [4]uint8{} {
+		return nil, ErrNoServer
+	}
+
+	target := host
+	for q := 0; q < maxQueries; q++ {
+		records, err := r.query(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		ip, last, ttl, ok := resolve(records, target)
+		if ok {
+			r.store(host, ip, ttl)
+			return ip[:], nil
+		}
+		if strings.EqualFold(last, target) {
+			// no answer for this name
+			return nil, ErrNotFound
+		}
+		// the chain ends on an alias, ask for it
+		target = last
+	}
+	return nil, ErrNotFound
+}
+
+// query sends the A query for the name and returns the answers
+func (r *Resolver) query(ctx context.Context, name string) ([]record, error) {
+	sock, err := r.wiznet.Open(w5100.Mode.UDP, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer sock.Close()
+
+	for try := 0; try < r.Retries; try++ {
+		r.id++
+		msg, err := buildQuery(r.buf[:], r.id, name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := sock.SendToContext(ctx, r.server[:], Port, msg); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(r.Timeout)
+		for time.Now().Before(deadline) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			data, ip, port := sock.RecvFrom()
+			if data == nil || port != Port || [4]uint8(ip) != r.server {
+				continue
+			}
+			records, err := parseResponse(data, r.id)
+			if err == ErrFormat {
+				// not our answer
+				continue
+			}
+			return records, err
+		}
+	}
+	return nil, w5100.ErrTimeout
+}
+
+// cached returns the address of the name if it is in the cache
+func (r *Resolver) cached(name string) ([4]uint8, bool) {
+	now := time.Now()
+	for _, e := range r.cache {
+		if e.name != "" && strings.EqualFold(e.name, name) && now.Before(e.expires) {
+			return e.ip, true
+		}
+	}
+	return [4]uint8{}, false
+}
+
+// store caches the address, replacing the entry which expires first
+func (r *Resolver) store(name string, ip [4]uint8, ttl uint32) {
+	if ttl == 0 {
+		return
+	}
+	victim := 0
+	for i, e := range r.cache {
+		if e.name == "" || strings.EqualFold(e.name, name) {
+			victim = i
+			break
+		}
+		if e.expires.Before(r.cache[victim].expires) {
+			victim = i
+		}
+	}
+	r.cache[victim] = entry{
+		name:    name,
+		ip:      ip,
+		expires: time.Now().Add(time.Duration(ttl) * time.Second),
+	}
+}
+
+// Flush empties the cache
+func (r *Resolver) Flush() {
+	r.cache = [cacheSize]entry{}
+}
+
+// Dial resolves the host of the "host:port" address and opens a
+// TCP connection to it on a free socket
+func (r *Resolver) Dial(ctx context.Context, address string) (*w5100.Conn, error) {
+	i := strings.LastIndexByte(address, ':')
+	if i < 0 {
+		return nil, w5100.ErrInvalidPort
+	}
+	port, err := strconv.ParseUint(address[i+1:], 10, 16)
+	if err != nil || port == 0 {
+		return nil, w5100.ErrInvalidPort
+	}
+	ip, err := r.LookupHost(ctx, address[:i])
+	if err != nil {
+		return nil, err
+	}
+
+	sock, err := r.wiznet.Open(w5100.Mode.TCP, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := sock.ConnectContext(ctx, ip, uint16(port)); err != nil {
+		sock.Close()
+		return nil, err
+	}
+	return w5100.NewConn(sock), nil
+}
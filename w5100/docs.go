@@ -8,9 +8,56 @@
 //  w.SetMACAddress([]uint8{0x00, 0x08, 0xDC, 0xAF, 0xEE, 0x00})
 //  w.SetIPAddress([]uint8{192, 168, 1, 15})
 //
+// or apply a whole (validated) configuration, e.g. loaded from storage
+//  cfg, err := w5100.ParseNetConfig("ip=192.168.1.15/24 gw=192.168.1.1 mac=00:08:dc:af:ee:00")
+//  err = cfg.Apply(w)
+//
+// Init uses the AVR SPI of the Uno. On other boards (or on a host)
+// the chip can be driven through any Bus implementation
+//  w := w5100.New(w5100.NewMachineSPI(machine.SPI0, machine.D10))
+//  w := w5100.New(emulator.New())
+//
 // You can also open a socket
 //  socketID := uint8(0)
 //  port := uint16(30000)
 //  flags := uint8(0)
 //  sock, err := w.Socket(socketID, w5100.Mode.TCP, port, flags)
+//
+// or let the driver pick a free slot (it is released on Close)
+//  sock, err := w.Open(w5100.Mode.UDP, port, flags)
+//  defer sock.Close()
+//
+// The received data can be read into a buffer owned by the caller,
+// so that the main loop does not allocate (the heap is tiny)
+//  var buf [64]uint8
+//  n, err := sock.ReadInto(buf[:])
+//
+// Small writes can be staged in the Tx memory and sent in a single
+// packet
+//  sock.Stage([]uint8("HTTP/1.0 200 OK\r\n"))
+//  sock.Stage([]uint8("\r\n"))
+//  err = sock.Flush()
+//
+// A TCP server accepting clients on slots 0 and 1 can be written
+// with the standard net interfaces
+//  l, err := w.Listen(80, 0, 1)
+//  conn, err := l.Accept()
+//  line, err := bufio.NewReader(conn).ReadString('\n')
+//
+// Instead of polling the registers, the socket events can be
+// delivered by a dispatcher (reading IR only when INT is asserted)
+//  d := w.NewDispatcher()
+//  d.AttachPin(machine.D2)
+//  d.Handle(sock.ID(), w5100.Interrupt.RECV|w5100.Interrupt.DISCON, onEvent)
+//  for {
+//  	d.Dispatch()
+//  }
+//
+// Several services can share the main loop with a cooperative
+// scheduler: it polls every socket once per pass and calls the
+// handlers that must not block
+//  s := w.NewScheduler()
+//  s.Watch(sock.ID(), w5100.PollAccepted|w5100.PollReadable, onHTTP)
+//  s.Every(0, func() { mqttClient.Poll(ctx) })
+//  s.Run(ctx)
 package w5100
@@ -0,0 +1,307 @@
+package emulator
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+// bridge forwards the traffic of the emulated sockets to real
+// sockets of the host
+type bridge struct {
+	host  string
+	links [w5100.MaxSockNum]*link
+}
+
+// link is the host side of an emulated socket
+type link struct {
+	ln   net.Listener
+	conn net.Conn
+	udp  *net.UDPConn
+
+	// the packets sent by the host wait here for the writer so that
+	// a peer which does not read never blocks the chip
+	mu      sync.Mutex
+	pending []Packet
+	closed  bool
+	wake    chan struct{}
+}
+
+// queue appends a packet for the writer, it never blocks
+func (l *link) queue(p Packet) {
+	l.mu.Lock()
+	l.pending = append(l.pending, p)
+	l.mu.Unlock()
+	l.signal()
+}
+
+// close stops the writer once the queued packets are written
+func (l *link) close() {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.signal()
+}
+
+// signal wakes the writer up (if it waits)
+func (l *link) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the queued packets. It waits for some packets and
+// returns false once the link is closed and the queue is empty.
+func (l *link) next() ([]Packet, bool) {
+	for {
+		l.mu.Lock()
+		packets, closed := l.pending, l.closed
+		l.pending = nil
+		l.mu.Unlock()
+		if len(packets) > 0 {
+			return packets, true
+		}
+		if closed {
+			return nil, false
+		}
+		<-l.wake
+	}
+}
+
+// NewBridged returns a chip whose TCP and UDP sockets are bridged
+// to host sockets: LISTEN and OPEN (UDP) bind on the given host
+// address ("127.0.0.1" if empty), CONNECT dials the address set
+// in DIPR/DPORT and SEND forwards the Tx memory to the peer.
+// Incoming bytes land in the Rx memory as soon as there is room.
+func NewBridged(host string) *Chip {
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	c := New()
+	c.bridge = &bridge{host: host}
+	return c
+}
+
+// hostAddr formats an address for the net package
+func hostAddr(host string, port uint16) string {
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+// attach registers a new link for the socket (closing the previous one)
+func (c *Chip) attach(id int, l *link) {
+	c.detach(id)
+	l.wake = make(chan struct{}, 1)
+	c.bridge.links[id] = l
+	go c.writeLoop(l)
+}
+
+// detach closes the host side of the socket
+func (c *Chip) detach(id int) {
+	l := c.bridge.links[id]
+	if l == nil {
+		return
+	}
+	c.bridge.links[id] = nil
+	l.close()
+	if l.ln != nil {
+		l.ln.Close()
+	}
+	if l.udp != nil {
+		l.udp.Close()
+	}
+}
+
+// alive tells whether the link is still the one of the socket
+// (it must be called with the lock)
+func (c *Chip) alive(id int, l *link) bool {
+	return c.bridge.links[id] == l
+}
+
+// bridgeOpen binds a UDP socket
+func (c *Chip) bridgeOpen(id int) {
+	if c.status(id) != w5100.Status.UDP {
+		c.detach(id)
+		return
+	}
+	port := c.sockRead16(id, w5100.SocketRegister.PORT)
+	addr, err := net.ResolveUDPAddr("udp4", hostAddr(c.bridge.host, port))
+	if err != nil {
+		c.setStatus(id, w5100.Status.CLOSED)
+		return
+	}
+	udp, err := net.ListenUDP("udp4", addr)
+	if err != nil {
+		c.setStatus(id, w5100.Status.CLOSED)
+		return
+	}
+	l := &link{udp: udp}
+	c.attach(id, l)
+	go c.udpReadLoop(id, l)
+}
+
+// bridgeListen binds a TCP listener, the first accepted
+// connection establishes the socket
+func (c *Chip) bridgeListen(id int) {
+	port := c.sockRead16(id, w5100.SocketRegister.PORT)
+	ln, err := net.Listen("tcp4", hostAddr(c.bridge.host, port))
+	if err != nil {
+		c.setStatus(id, w5100.Status.CLOSED)
+		c.interrupt(id, w5100.Interrupt.TIMEOUT)
+		return
+	}
+	l := &link{ln: ln}
+	c.attach(id, l)
+	go func() {
+		conn, err := ln.Accept()
+		// a W5100 socket serves a single connection
+		ln.Close()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.alive(id, l) {
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			c.setStatus(id, w5100.Status.CLOSED)
+			c.interrupt(id, w5100.Interrupt.TIMEOUT)
+			return
+		}
+		c.established(id, l, conn)
+	}()
+}
+
+// bridgeConnect dials the destination in the background,
+// the socket remains in SYNSENT meanwhile
+func (c *Chip) bridgeConnect(id int) {
+	var ip net.IP = make([]byte, 4)
+	copy(ip, c.mem[regAddr(id, w5100.SocketRegister.DIPR):])
+	port := c.sockRead16(id, w5100.SocketRegister.DPORT)
+	l := &link{}
+	c.attach(id, l)
+	c.setStatus(id, w5100.Status.SYNSENT)
+	go func() {
+		conn, err := net.DialTimeout("tcp4", hostAddr(ip.String(), port), 10*time.Second)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.alive(id, l) {
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			c.setStatus(id, w5100.Status.CLOSED)
+			c.interrupt(id, w5100.Interrupt.TIMEOUT)
+			return
+		}
+		c.established(id, l, conn)
+	}()
+}
+
+// established moves the socket to ESTABLISHED once the host
+// connection is up (it must be called with the lock)
+func (c *Chip) established(id int, l *link, conn net.Conn) {
+	l.conn = conn
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		copy(c.mem[regAddr(id, w5100.SocketRegister.DIPR):], addr.IP.To4())
+		c.sockWrite16(id, w5100.SocketRegister.DPORT, uint16(addr.Port))
+	}
+	c.setStatus(id, w5100.Status.ESTABLISHED)
+	c.interrupt(id, w5100.Interrupt.CON)
+	go c.tcpReadLoop(id, l)
+}
+
+// bridgeSend queues a packet for the writer of the link. It is
+// called with the lock so it must not wait for the host socket.
+func (c *Chip) bridgeSend(id int, p Packet) {
+	if l := c.bridge.links[id]; l != nil {
+		l.queue(p)
+	}
+}
+
+// writeLoop writes the queued packets to the host socket
+func (c *Chip) writeLoop(l *link) {
+	for {
+		packets, ok := l.next()
+		if !ok {
+			break
+		}
+		for _, p := range packets {
+			c.mu.Lock()
+			conn := l.conn
+			c.mu.Unlock()
+			switch {
+			case conn != nil:
+				conn.Write(p.Data)
+			case l.udp != nil:
+				addr := &net.UDPAddr{IP: net.IP(p.IP[:]), Port: int(p.Port)}
+				l.udp.WriteToUDP(p.Data, addr)
+			}
+		}
+	}
+	c.mu.Lock()
+	conn := l.conn
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// tcpReadLoop copies the incoming stream into the Rx memory
+func (c *Chip) tcpReadLoop(id int, l *link) {
+	buf := make([]uint8, 1024)
+	for {
+		n, err := l.conn.Read(buf)
+		data := buf[:n]
+		for len(data) > 0 {
+			c.mu.Lock()
+			if !c.alive(id, l) {
+				c.mu.Unlock()
+				return
+			}
+			k := c.push(id, data)
+			c.mu.Unlock()
+			data = data[k:]
+			if k == 0 {
+				// wait for the host to consume the Rx memory
+				time.Sleep(time.Millisecond)
+			}
+		}
+		if err != nil {
+			c.mu.Lock()
+			if c.alive(id, l) && c.status(id) == w5100.Status.ESTABLISHED {
+				c.setStatus(id, w5100.Status.CLOSE_WAIT)
+				c.interrupt(id, w5100.Interrupt.DISCON)
+			}
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// udpReadLoop stores the incoming datagrams (with their header)
+// into the Rx memory. Datagrams which do not fit are dropped.
+func (c *Chip) udpReadLoop(id int, l *link) {
+	buf := make([]uint8, 2048)
+	for {
+		n, addr, err := l.udp.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var ip [4]uint8
+		copy(ip[:], addr.IP.To4())
+		c.mu.Lock()
+		if !c.alive(id, l) {
+			c.mu.Unlock()
+			return
+		}
+		c.pushDatagram(id, ip, uint16(addr.Port), buf[:n])
+		c.mu.Unlock()
+	}
+}
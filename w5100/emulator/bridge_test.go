@@ -0,0 +1,135 @@
+package emulator
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+// freePort returns a port of the loopback which is not in use
+func freePort(t *testing.T) uint16 {
+	t.Helper()
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestBridgeTCP(t *testing.T) {
+	chip := NewBridged("")
+	w := w5100.New(chip)
+	port := freePort(t)
+	sock, _ := w.Socket(0, w5100.Mode.TCP, port, 0)
+	if err := sock.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp4", hostAddr("127.0.0.1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]uint8("hello\n"))
+	sock.SetTimeout(2 * time.Second)
+	buf := make([]uint8, 16)
+	var got []uint8
+	for len(got) < 6 {
+		n, err := sock.Read(buf)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != "hello\n" {
+		t.Fatalf("received %q", got)
+	}
+	sock.Send([]uint8("world\n"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if line, _ := bufio.NewReader(conn).ReadString('\n'); line != "world\n" {
+		t.Fatalf("the peer received %q", line)
+	}
+}
+
+// TestBridgeSlowPeer checks that a peer which does not read does not
+// block the chip (the SPI transfers go on)
+func TestBridgeSlowPeer(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+
+	chip := NewBridged("")
+	w := w5100.New(chip)
+	sock, _ := w.Socket(1, w5100.Mode.TCP, 0, 0)
+	sock.SetTimeout(2 * time.Second)
+	port := uint16(ln.Addr().(*net.TCPAddr).Port)
+	if err := sock.Connect([]uint8{127, 0, 0, 1}, port); err != nil {
+		t.Fatal(err)
+	}
+	conn := <-accepted
+	defer conn.Close()
+
+	// far more than the socket buffers of the host
+	done := make(chan error, 1)
+	go func() {
+		data := make([]uint8, 2048)
+		for i := 0; i < 4096; i++ {
+			if _, err := sock.Write(data); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("the chip is blocked by the peer")
+	}
+}
+
+func TestBridgeUDP(t *testing.T) {
+	chip := NewBridged("")
+	w := w5100.New(chip)
+	port := freePort(t)
+	sock, _ := w.Socket(2, w5100.Mode.UDP, port, 0)
+	conn, err := net.Dial("udp4", hostAddr("127.0.0.1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]uint8("ping"))
+
+	var data []uint8
+	var from []uint8
+	var fromPort uint16
+	for i := 0; i < 200 && data == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		data, from, fromPort = sock.RecvFrom()
+	}
+	if string(data) != "ping" {
+		t.Fatalf("received %q", data)
+	}
+	if _, err := sock.SendTo(from, fromPort, []uint8("pong")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]uint8, 16)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, _ := conn.Read(buf); string(buf[:n]) != "pong" {
+		t.Fatalf("the peer received %q", buf[:n])
+	}
+}
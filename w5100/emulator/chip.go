@@ -0,0 +1,198 @@
+package emulator
+
+import (
+	"sync"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+// memory map boundaries (see w5100/op.go)
+const (
+	memSize   = 0x8000
+	commonEnd = 0x0030
+	socketEnd = w5100.CH_BASE + w5100.MaxSockNum*w5100.CH_SIZE
+	bufTotal  = 0x2000
+)
+
+// Chip is a software W5100. It implements the w5100.Bus interface
+// and can be shared between goroutines (the driver on one side,
+// the remote peers on the other).
+type Chip struct {
+	mu      sync.Mutex
+	mem     [memSize]uint8
+	frame   [4]uint8
+	n       int
+	sockets [w5100.MaxSockNum]socket
+	bridge  *bridge
+}
+
+// New returns a chip in its reset state
+func New() *Chip {
+	c := &Chip{}
+	c.reset()
+	return c
+}
+
+// Select starts a new SPI frame
+func (c *Chip) Select() {
+	c.n = 0
+}
+
+// Deselect ends the current SPI frame
+func (c *Chip) Deselect() {
+	c.n = 0
+}
+
+// Transfer receives one byte of the 4-byte frame. Like the real chip
+// it answers 0x00, 0x01, 0x02 during the first three bytes and the
+// register value on the last one (READ).
+func (c *Chip) Transfer(data uint8) uint8 {
+	if c.n >= len(c.frame) {
+		return 0
+	}
+	c.frame[c.n] = data
+	c.n++
+	if c.n < len(c.frame) {
+		return uint8(c.n - 1)
+	}
+
+	addr := uint16(c.frame[1])<<8 | uint16(c.frame[2])
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.frame[0] {
+	case w5100.READ:
+		return c.load(addr)
+	case w5100.WRITE:
+		c.store(addr, data)
+	}
+	return 0
+}
+
+// Read returns the value of the register (or memory cell) at addr
+func (c *Chip) Read(addr uint16) uint8 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load(addr)
+}
+
+// Read16 returns the 16-bit big endian value stored at addr
+func (c *Chip) Read16(addr uint16) uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get16(addr)
+}
+
+// load is a read from the host point of view
+func (c *Chip) load(addr uint16) uint8 {
+	if addr >= memSize {
+		return 0
+	}
+	if addr == w5100.IR {
+		// the socket bits reflect the SnIR registers
+		ir := c.mem[addr] &^ w5100.IR_SOCKETS
+		for id := range c.sockets {
+			if c.sockRead(id, w5100.SocketRegister.IR) != 0 {
+				ir |= 1 << id
+			}
+		}
+		return ir
+	}
+	return c.mem[addr]
+}
+
+// store is a write from the host point of view
+func (c *Chip) store(addr uint16, data uint8) {
+	switch {
+	case addr >= memSize:
+		return
+	case addr < commonEnd:
+		c.storeCommon(addr, data)
+	case addr >= w5100.CH_BASE && addr < socketEnd:
+		id := int((addr - w5100.CH_BASE) / w5100.CH_SIZE)
+		c.storeSocket(id, (addr-w5100.CH_BASE)%w5100.CH_SIZE, data)
+	case addr >= w5100.TxBufBase:
+		// Tx memory is written by the host, Rx memory
+		// is read-only but writing it does not hurt
+		c.mem[addr] = data
+	}
+}
+
+func (c *Chip) storeCommon(addr uint16, data uint8) {
+	if addr == w5100.MR && data&(1<<w5100.RST) != 0 {
+		c.reset()
+		return
+	}
+	if addr == w5100.IR {
+		// write 1 to clear
+		c.mem[addr] &^= data
+		return
+	}
+	c.mem[addr] = data
+}
+
+// reset restores the default values of all the registers
+func (c *Chip) reset() {
+	for i := uint16(0); i < socketEnd; i++ {
+		c.mem[i] = 0
+	}
+	// 2KB per socket
+	c.mem[w5100.RMSR] = 0x55
+	c.mem[w5100.TMSR] = 0x55
+	for id := range c.sockets {
+		if c.bridge != nil {
+			c.detach(id)
+		}
+		c.sockets[id] = socket{}
+		c.resetPointers(id)
+	}
+}
+
+// get16 reads a 16-bit big endian value
+func (c *Chip) get16(addr uint16) uint16 {
+	return uint16(c.mem[addr])<<8 | uint16(c.mem[addr+1])
+}
+
+// set16 writes a 16-bit big endian value
+func (c *Chip) set16(addr uint16, v uint16) {
+	c.mem[addr] = uint8(v >> 8)
+	c.mem[addr+1] = uint8(v)
+}
+
+// memSizes returns the size of the buffer of each socket
+// given the value of RMSR or TMSR (2 bits per socket, socket 0
+// in the least significant bits). Like the chip, a socket gets
+// nothing when the previous ones have taken the whole 8KB.
+func memSizes(msr uint8) (sizes [w5100.MaxSockNum]uint16) {
+	var total uint16
+	for i := range sizes {
+		s := uint16(1024) << ((msr >> (2 * i)) & 0x03)
+		if total+s > bufTotal {
+			s = bufTotal - total
+		}
+		sizes[i] = s
+		total += s
+	}
+	return sizes
+}
+
+// txBuffer returns the base address and the size of the Tx
+// buffer of the socket
+func (c *Chip) txBuffer(id int) (uint16, uint16) {
+	sizes := memSizes(c.mem[w5100.TMSR])
+	base := w5100.TxBufBase
+	for i := 0; i < id; i++ {
+		base += sizes[i]
+	}
+	return base, sizes[id]
+}
+
+// rxBuffer returns the base address and the size of the Rx
+// buffer of the socket
+func (c *Chip) rxBuffer(id int) (uint16, uint16) {
+	sizes := memSizes(c.mem[w5100.RMSR])
+	base := w5100.RxBufBase
+	for i := 0; i < id; i++ {
+		base += sizes[i]
+	}
+	return base, sizes[id]
+}
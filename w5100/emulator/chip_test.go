@@ -0,0 +1,158 @@
+package emulator
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+// pattern returns n bytes which differ from one offset to the next
+func pattern(n int, seed uint8) []uint8 {
+	data := make([]uint8, n)
+	for i := range data {
+		data[i] = uint8(i*7) + seed
+	}
+	return data
+}
+
+func TestFrames(t *testing.T) {
+	c := New()
+	c.Select()
+	for i, b := range []uint8{w5100.WRITE, 0x00, uint8(w5100.SIPR + 3), 42} {
+		if got := c.Transfer(b); got != uint8(i) && i < 3 {
+			t.Errorf("byte %d: answered %d", i, got)
+		}
+	}
+	c.Deselect()
+	if c.Read(w5100.SIPR+3) != 42 {
+		t.Error("write frame not decoded")
+	}
+	c.Select()
+	for _, b := range []uint8{w5100.READ, 0x00, uint8(w5100.SIPR + 3)} {
+		c.Transfer(b)
+	}
+	if got := c.Transfer(0); got != 42 {
+		t.Errorf("read frame: got %d", got)
+	}
+	c.Deselect()
+}
+
+func TestCommands(t *testing.T) {
+	c := New()
+	w := w5100.New(c)
+	sock, _ := w.Socket(1, w5100.Mode.TCP, 80, 0)
+	if c.Status(1) != w5100.Status.INIT {
+		t.Fatalf("OPEN: status %#x", c.Status(1))
+	}
+	if err := sock.Connect([]uint8{10, 0, 0, 1}, 80); err != nil {
+		t.Fatal(err)
+	}
+	if c.Status(1) != w5100.Status.ESTABLISHED {
+		t.Fatalf("CONNECT: status %#x", c.Status(1))
+	}
+	sock.Disconnect()
+	if c.Status(1) != w5100.Status.CLOSED {
+		t.Fatalf("DISCON: status %#x", c.Status(1))
+	}
+
+	udp, _ := w.Socket(2, w5100.Mode.UDP, 53, 0)
+	if c.Status(2) != w5100.Status.UDP {
+		t.Fatalf("OPEN: status %#x", c.Status(2))
+	}
+	udp.Close()
+	if c.Status(2) != w5100.Status.CLOSED {
+		t.Fatalf("CLOSE: status %#x", c.Status(2))
+	}
+	sock.Close()
+	if _, err := w.Socket(1, w5100.Mode.MACRAW, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if c.Status(1) != w5100.Status.CLOSED {
+		t.Errorf("MACRAW opened on slot 1")
+	}
+}
+
+// TestTxWraparound checks that a SEND crossing the end of the Tx
+// memory is split at the right place (sendDataProcessingOffset)
+func TestTxWraparound(t *testing.T) {
+	c := New()
+	w := w5100.New(c)
+	sock, _ := w.Socket(1, w5100.Mode.TCP, 80, 0)
+	sock.Connect([]uint8{10, 0, 0, 1}, 80)
+
+	sock.Send(make([]uint8, 1500))
+	c.Sent(1)
+	data := pattern(1000, 1)
+	if n := sock.Send(data); n != 1000 {
+		t.Fatalf("sent %d bytes", n)
+	}
+
+	base := w5100.TxBufBase + sock.TxSize() // slot 1
+	for i, b := range data {
+		addr := base + (1500+uint16(i))%sock.TxSize()
+		if c.Read(addr) != b {
+			t.Fatalf("byte %d stored at %#x: %d, want %d", i, addr, c.Read(addr), b)
+		}
+	}
+	if sent := c.SentBytes(1); !bytes.Equal(sent, data) {
+		t.Error("the peer received corrupted data")
+	}
+	if wr := c.Read16(regAddr(1, w5100.SocketRegister.TxWR)); wr != 2500 {
+		t.Errorf("TxWR %d", wr)
+	}
+}
+
+// TestRxWraparound checks that data crossing the end of the Rx
+// memory is read back in order (readData)
+func TestRxWraparound(t *testing.T) {
+	c := New()
+	w := w5100.New(c)
+	sock, _ := w.Socket(2, w5100.Mode.TCP, 80, 0)
+	sock.Listen()
+	c.Accept(2, [4]uint8{10, 0, 0, 1}, 5000)
+
+	c.Deliver(2, make([]uint8, 1500))
+	sock.Recv(2048)
+	data := pattern(1000, 3)
+	c.Deliver(2, data)
+
+	base := w5100.RxBufBase + 2*sock.RxSize() // slot 2
+	if c.Read(base+1500) != data[0] || c.Read(base) != data[548] {
+		t.Fatal("the data does not wrap around the Rx memory")
+	}
+	if got := sock.Recv(2048); !bytes.Equal(got, data) {
+		t.Fatalf("received %d bytes out of order", len(got))
+	}
+	buf := make([]uint8, 1000)
+	c.Deliver(2, data)
+	if n, err := sock.ReadInto(buf); n != 1000 || err != nil || !bytes.Equal(buf, data) {
+		t.Fatalf("ReadInto: %d, %v", n, err)
+	}
+}
+
+// TestPointerOverflow runs the 16-bit Tx/Rx pointers past 0xFFFF
+func TestPointerOverflow(t *testing.T) {
+	c := New()
+	w := w5100.New(c)
+	sock, _ := w.Socket(0, w5100.Mode.TCP, 80, 0)
+	sock.Listen()
+	c.Accept(0, [4]uint8{10, 0, 0, 1}, 5000)
+
+	for i := 0; i < 40; i++ {
+		data := pattern(1999, uint8(i))
+		c.Deliver(0, data)
+		if got := sock.Recv(2048); !bytes.Equal(got, data) {
+			t.Fatalf("round %d: received corrupted data", i)
+		}
+		if n := sock.Send(data); n != 1999 {
+			t.Fatalf("round %d: sent %d bytes", i, n)
+		}
+		if sent := c.SentBytes(0); !bytes.Equal(sent, data) {
+			t.Fatalf("round %d: sent corrupted data", i)
+		}
+	}
+	if rd := c.Read16(regAddr(0, w5100.SocketRegister.RxRD)); rd != uint16(40*1999%0x10000) {
+		t.Errorf("RxRD %d", rd)
+	}
+}
@@ -0,0 +1,30 @@
+// Package emulator provides a register-level software model of the
+// wiznet W5100 chip so that the w5100 driver can run on a host
+//
+// # Examples
+//
+// The Chip implements the w5100.Bus interface. It decodes the SPI
+// frames, holds the registers and the Tx/Rx memory and reacts to
+// the socket commands like the real chip
+//
+//	chip := emulator.New()
+//	w := w5100.New(chip)
+//	sock, err := w.Socket(0, w5100.Mode.TCP, 80, 0)
+//	sock.Listen()
+//
+// The remote side of a socket is driven through the chip
+//
+//	chip.Accept(0, [4]uint8{192, 168, 1, 20}, 51000)
+//	chip.Deliver(0, []uint8("GET / HTTP/1.0\r\n\r\n"))
+//	data := sock.Recv(2048)
+//	sock.Send([]uint8("HTTP/1.0 200 OK\r\n\r\n"))
+//	sent := chip.SentBytes(0)
+//
+// A bridged chip forwards its TCP and UDP sockets to the host so that
+// the firmware can be reached with curl or netcat
+//
+//	chip := emulator.NewBridged("127.0.0.1")
+//	w := w5100.New(chip)
+//	sock, err := w.Socket(0, w5100.Mode.TCP, 8080, 0)
+//	sock.Listen() // nc 127.0.0.1 8080
+package emulator
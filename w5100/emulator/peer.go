@@ -0,0 +1,116 @@
+package emulator
+
+import "github.com/asiffer/arduigo/w5100"
+
+// Status returns the SnSR register of the socket
+func (c *Chip) Status(id int) uint8 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status(id)
+}
+
+// Accept simulates a remote client connecting to a socket in
+// LISTEN state. It returns false if the socket is not listening.
+func (c *Chip) Accept(id int, ip [4]uint8, port uint16) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status(id) != w5100.Status.LISTEN {
+		return false
+	}
+	copy(c.mem[regAddr(id, w5100.SocketRegister.DIPR):], ip[:])
+	c.sockWrite16(id, w5100.SocketRegister.DPORT, port)
+	c.setStatus(id, w5100.Status.ESTABLISHED)
+	c.interrupt(id, w5100.Interrupt.CON)
+	return true
+}
+
+// Deliver simulates data received on a TCP connection. The data
+// is truncated to the free space of the Rx memory, the number
+// of accepted bytes is returned.
+func (c *Chip) Deliver(id int, data []uint8) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.status(id) {
+	case w5100.Status.ESTABLISHED:
+	default:
+		return 0
+	}
+	return c.push(id, data)
+}
+
+// DeliverDatagram simulates a datagram received by a socket in
+// UDP or IPRAW mode. The chip prefixes the payload with the peer
+// address (8 bytes in UDP mode, 6 bytes in IPRAW mode). The
+// datagram is dropped (false returned) when it does not fit.
+func (c *Chip) DeliverDatagram(id int, ip [4]uint8, port uint16, data []uint8) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pushDatagram(id, ip, port, data)
+}
+
+// DeliverFrame simulates an Ethernet frame received by a socket in
+// MACRAW mode. The chip prefixes the frame with its length. The
+// frame is dropped (false returned) when it does not fit.
+func (c *Chip) DeliverFrame(id int, frame []uint8) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pushFrame(id, frame)
+}
+
+// Unreachable simulates an ICMP destination unreachable message
+// received for a datagram sent to the address (IR UNREACH)
+func (c *Chip) Unreachable(ip [4]uint8, port uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	copy(c.mem[w5100.UIPR:], ip[:])
+	c.set16(w5100.UPORT, port)
+	c.mem[w5100.IR] |= w5100.IR_UNREACH
+}
+
+// Conflict simulates an ARP request from another host using the IP
+// address of the chip (IR CONFLICT)
+func (c *Chip) Conflict() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mem[w5100.IR] |= w5100.IR_CONFLICT
+}
+
+// RemoteClose simulates the peer closing its side of a TCP
+// connection (FIN received)
+func (c *Chip) RemoteClose(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status(id) == w5100.Status.ESTABLISHED {
+		c.setStatus(id, w5100.Status.CLOSE_WAIT)
+		c.interrupt(id, w5100.Interrupt.DISCON)
+	}
+}
+
+// Timeout simulates a TCP timeout (ARP or retransmission):
+// the socket is closed and the TIMEOUT interrupt is raised
+func (c *Chip) Timeout(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setStatus(id, w5100.Status.CLOSED)
+	c.interrupt(id, w5100.Interrupt.TIMEOUT)
+}
+
+// Sent returns (and forgets) the packets sent by the host, even
+// if the socket has been closed or open again since then
+func (c *Chip) Sent(id int) []Packet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sent := c.sockets[id].sent
+	c.sockets[id].sent = nil
+	return sent
+}
+
+// SentBytes returns (and forgets) the concatenation of the
+// data sent by the host. It is convenient for TCP streams.
+func (c *Chip) SentBytes(id int) []uint8 {
+	var data []uint8
+	for _, p := range c.Sent(id) {
+		data = append(data, p.Data...)
+	}
+	return data
+}
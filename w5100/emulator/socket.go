@@ -0,0 +1,270 @@
+package emulator
+
+import "github.com/asiffer/arduigo/w5100"
+
+// Packet is a chunk of data sent by the host through a socket.
+// In TCP mode a packet is the content of a single SEND command.
+type Packet struct {
+	IP   [4]uint8
+	Port uint16
+	Data []uint8
+}
+
+// socket is the internal state of a channel which is not
+// visible through the registers
+type socket struct {
+	sent []Packet
+}
+
+// regAddr returns the absolute address of a socket register
+func regAddr(id int, reg uint16) uint16 {
+	return w5100.CH_BASE + uint16(id)*w5100.CH_SIZE + reg
+}
+
+func (c *Chip) sockRead(id int, reg uint16) uint8 {
+	return c.mem[regAddr(id, reg)]
+}
+
+func (c *Chip) sockWrite(id int, reg uint16, v uint8) {
+	c.mem[regAddr(id, reg)] = v
+}
+
+func (c *Chip) sockRead16(id int, reg uint16) uint16 {
+	return c.get16(regAddr(id, reg))
+}
+
+func (c *Chip) sockWrite16(id int, reg uint16, v uint16) {
+	c.set16(regAddr(id, reg), v)
+}
+
+// storeSocket handles a host write into a socket register
+func (c *Chip) storeSocket(id int, reg uint16, data uint8) {
+	switch reg {
+	case w5100.SocketRegister.CR:
+		c.command(id, data)
+	case w5100.SocketRegister.IR:
+		// bits are cleared by writing 1
+		c.sockWrite(id, reg, c.sockRead(id, reg)&^data)
+	case w5100.SocketRegister.SR,
+		w5100.SocketRegister.TxFSR, w5100.SocketRegister.TxFSR + 1,
+		w5100.SocketRegister.TxRD, w5100.SocketRegister.TxRD + 1,
+		w5100.SocketRegister.RxRSR, w5100.SocketRegister.RxRSR + 1,
+		w5100.SocketRegister.RxWR, w5100.SocketRegister.RxWR + 1:
+		// read-only registers
+	default:
+		c.sockWrite(id, reg, data)
+	}
+}
+
+// resetPointers sets the socket buffers in their empty state
+func (c *Chip) resetPointers(id int) {
+	_, txSize := c.txBuffer(id)
+	c.sockWrite16(id, w5100.SocketRegister.TxFSR, txSize)
+	c.sockWrite16(id, w5100.SocketRegister.TxRD, 0)
+	c.sockWrite16(id, w5100.SocketRegister.TxWR, 0)
+	c.sockWrite16(id, w5100.SocketRegister.RxRSR, 0)
+	c.sockWrite16(id, w5100.SocketRegister.RxRD, 0)
+	c.sockWrite16(id, w5100.SocketRegister.RxWR, 0)
+}
+
+func (c *Chip) setStatus(id int, status uint8) {
+	c.sockWrite(id, w5100.SocketRegister.SR, status)
+}
+
+func (c *Chip) status(id int) uint8 {
+	return c.sockRead(id, w5100.SocketRegister.SR)
+}
+
+func (c *Chip) interrupt(id int, flag uint8) {
+	c.sockWrite(id, w5100.SocketRegister.IR, c.sockRead(id, w5100.SocketRegister.IR)|flag)
+}
+
+// command executes a SnCR command. Commands complete
+// immediately so SnCR always reads 0.
+func (c *Chip) command(id int, cmd uint8) {
+	switch cmd {
+	case w5100.Command.OPEN:
+		c.open(id)
+		if c.bridge != nil {
+			c.bridgeOpen(id)
+		}
+	case w5100.Command.LISTEN:
+		if c.status(id) == w5100.Status.INIT {
+			c.setStatus(id, w5100.Status.LISTEN)
+			if c.bridge != nil {
+				c.bridgeListen(id)
+			}
+		}
+	case w5100.Command.CONNECT:
+		if c.status(id) != w5100.Status.INIT {
+			break
+		}
+		if c.bridge != nil {
+			c.bridgeConnect(id)
+			break
+		}
+		// the default peer accepts every connection
+		c.setStatus(id, w5100.Status.ESTABLISHED)
+		c.interrupt(id, w5100.Interrupt.CON)
+	case w5100.Command.DISCON:
+		switch c.status(id) {
+		case w5100.Status.ESTABLISHED, w5100.Status.CLOSE_WAIT,
+			w5100.Status.SYNSENT, w5100.Status.SYNRECV:
+			c.setStatus(id, w5100.Status.CLOSED)
+			c.interrupt(id, w5100.Interrupt.DISCON)
+			if c.bridge != nil {
+				c.detach(id)
+			}
+		}
+	case w5100.Command.CLOSE:
+		c.setStatus(id, w5100.Status.CLOSED)
+		if c.bridge != nil {
+			c.detach(id)
+		}
+	case w5100.Command.SEND, w5100.Command.SEND_MAC:
+		c.send(id)
+	case w5100.Command.SEND_KEEP:
+	case w5100.Command.RECV:
+		c.recv(id)
+	}
+	c.sockWrite(id, w5100.SocketRegister.CR, 0)
+}
+
+// open initializes the socket according to the protocol set in SnMR
+func (c *Chip) open(id int) {
+	var status uint8
+	switch c.sockRead(id, w5100.SocketRegister.MR) & 0x0F {
+	case w5100.Mode.TCP:
+		status = w5100.Status.INIT
+	case w5100.Mode.UDP:
+		status = w5100.Status.UDP
+	case w5100.Mode.IPRAW:
+		status = w5100.Status.IPRAW
+	case w5100.Mode.MACRAW:
+		if id != 0 {
+			return
+		}
+		status = w5100.Status.MACRAW
+	case w5100.Mode.PPPOE:
+		if id != 0 {
+			return
+		}
+		status = w5100.Status.PPPOE
+	default:
+		return
+	}
+	c.resetPointers(id)
+	c.setStatus(id, status)
+}
+
+// send consumes the Tx memory between TxRD and TxWR
+func (c *Chip) send(id int) {
+	switch c.status(id) {
+	case w5100.Status.ESTABLISHED, w5100.Status.CLOSE_WAIT,
+		w5100.Status.UDP, w5100.Status.IPRAW, w5100.Status.MACRAW:
+	default:
+		return
+	}
+
+	base, size := c.txBuffer(id)
+	mask := size - 1
+	rd := c.sockRead16(id, w5100.SocketRegister.TxRD)
+	wr := c.sockRead16(id, w5100.SocketRegister.TxWR)
+	n := wr - rd
+	if n > size {
+		n = size
+	}
+
+	data := make([]uint8, n)
+	for i := range data {
+		data[i] = c.mem[base+((rd+uint16(i))&mask)]
+	}
+
+	p := Packet{Data: data}
+	copy(p.IP[:], c.mem[regAddr(id, w5100.SocketRegister.DIPR):])
+	p.Port = c.sockRead16(id, w5100.SocketRegister.DPORT)
+	if c.bridge != nil {
+		c.bridgeSend(id, p)
+	} else {
+		c.sockets[id].sent = append(c.sockets[id].sent, p)
+	}
+
+	c.sockWrite16(id, w5100.SocketRegister.TxRD, rd+n)
+	c.sockWrite16(id, w5100.SocketRegister.TxFSR, size)
+	c.interrupt(id, w5100.Interrupt.SEND_OK)
+}
+
+// recv acknowledges the data read by the host (up to RxRD)
+func (c *Chip) recv(id int) {
+	rd := c.sockRead16(id, w5100.SocketRegister.RxRD)
+	wr := c.sockRead16(id, w5100.SocketRegister.RxWR)
+	c.sockWrite16(id, w5100.SocketRegister.RxRSR, wr-rd)
+	if wr != rd {
+		// data is still pending
+		c.interrupt(id, w5100.Interrupt.RECV)
+	}
+}
+
+// push appends data into the Rx memory of the socket and returns
+// the number of bytes that were stored
+func (c *Chip) push(id int, data []uint8) int {
+	base, size := c.rxBuffer(id)
+	mask := size - 1
+	wr := c.sockRead16(id, w5100.SocketRegister.RxWR)
+	rsr := c.sockRead16(id, w5100.SocketRegister.RxRSR)
+	free := int(size - rsr)
+	if len(data) > free {
+		data = data[:free]
+	}
+	for i, b := range data {
+		c.mem[base+((wr+uint16(i))&mask)] = b
+	}
+	c.sockWrite16(id, w5100.SocketRegister.RxWR, wr+uint16(len(data)))
+	c.sockWrite16(id, w5100.SocketRegister.RxRSR, rsr+uint16(len(data)))
+	if len(data) > 0 {
+		c.interrupt(id, w5100.Interrupt.RECV)
+	}
+	return len(data)
+}
+
+// pushDatagram stores a datagram and its header into the Rx memory
+func (c *Chip) pushDatagram(id int, ip [4]uint8, port uint16, data []uint8) bool {
+	header := make([]uint8, 0, 8)
+	header = append(header, ip[:]...)
+	switch c.status(id) {
+	case w5100.Status.UDP:
+		header = append(header, uint8(port>>8), uint8(port))
+	case w5100.Status.IPRAW:
+	default:
+		return false
+	}
+	header = append(header, uint8(len(data)>>8), uint8(len(data)))
+
+	if len(header)+len(data) > c.rxFree(id) {
+		return false
+	}
+	c.push(id, header)
+	c.push(id, data)
+	return true
+}
+
+// pushFrame stores an Ethernet frame and its length (header
+// included) into the Rx memory
+func (c *Chip) pushFrame(id int, frame []uint8) bool {
+	if c.status(id) != w5100.Status.MACRAW {
+		return false
+	}
+	size := len(frame) + int(w5100.MACRAWHeaderSize)
+	if size > c.rxFree(id) {
+		return false
+	}
+	c.push(id, []uint8{uint8(size >> 8), uint8(size)})
+	c.push(id, frame)
+	return true
+}
+
+// rxFree returns the free space of the Rx memory
+func (c *Chip) rxFree(id int) int {
+	_, size := c.rxBuffer(id)
+	return int(size - c.sockRead16(id, w5100.SocketRegister.RxRSR))
+}
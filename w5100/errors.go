@@ -0,0 +1,65 @@
+package w5100
+
+import "errors"
+
+// timeoutError is the type of ErrTimeout. It implements net.Error
+// so that it is recognized as a timeout by the net users.
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "w5100: i/o timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
+
+// Errors returned by the package. They can be checked with errors.Is
+var (
+	// ErrInvalidSocket is returned when the socket number is greater
+	// than the maximum number of sockets
+	ErrInvalidSocket = errors.New("w5100: invalid socket number")
+	// ErrSocketBusy is returned when the slot is already owned
+	// by an open socket
+	ErrSocketBusy = errors.New("w5100: socket slot already in use")
+	// ErrNoFreeSocket is returned when all the slots are in use
+	ErrNoFreeSocket = errors.New("w5100: no free socket")
+	// ErrNoMemory is returned when the slot has no Tx or Rx memory
+	ErrNoMemory = errors.New("w5100: no buffer memory for this socket")
+	// ErrInvalidMemorySize is returned when the sizes given to
+	// SetMemorySizes cannot be programmed into the chip
+	ErrInvalidMemorySize = errors.New("w5100: invalid memory sizes")
+	// ErrBadProtocol is returned when the socket mode is unknown
+	ErrBadProtocol = errors.New("w5100: bad protocol")
+	// ErrNotInit is returned when the socket is not in INIT mode
+	// (TCP socket opened but neither listening nor connected)
+	ErrNotInit = errors.New("w5100: socket not in INIT mode")
+	// ErrInvalidMode is returned when the operation does not match
+	// the protocol of the socket (e.g. SendTo on a TCP socket)
+	ErrInvalidMode = errors.New("w5100: operation not supported in this socket mode")
+	// ErrInvalidAddress is returned when the IP address is malformed,
+	// null (0.0.0.0) or broadcast (255.255.255.255)
+	ErrInvalidAddress = errors.New("w5100: invalid IP address")
+	// ErrInvalidMask is returned when the subnet mask is not made of
+	// contiguous leading ones
+	ErrInvalidMask = errors.New("w5100: invalid subnet mask")
+	// ErrInvalidMAC is returned when the MAC address is not a 6 bytes
+	// unicast address
+	ErrInvalidMAC = errors.New("w5100: invalid MAC address")
+	// ErrInvalidConfig is returned when a network configuration
+	// cannot be parsed
+	ErrInvalidConfig = errors.New("w5100: invalid network configuration")
+	// ErrInvalidPort is returned when the port is set to zero
+	ErrInvalidPort = errors.New("w5100: invalid port")
+	// ErrBufferFull is returned when the data does not fit in the
+	// Tx memory of the socket
+	ErrBufferFull = errors.New("w5100: data larger than the socket buffer")
+	// ErrTruncated is returned when a received datagram or frame
+	// is larger than the buffer given to hold it (the rest is dropped)
+	ErrTruncated = errors.New("w5100: datagram larger than the buffer (truncated)")
+	// ErrInvalidFrame is returned when an Ethernet frame is too short,
+	// too long or when the chip reports a corrupted frame length
+	ErrInvalidFrame = errors.New("w5100: invalid ethernet frame")
+	// ErrTimeout is returned when an operation does not complete in
+	// time: deadline exceeded, TIMEOUT interrupt or wedged chip
+	ErrTimeout error = &timeoutError{}
+	// ErrClosed is returned when the socket is (or gets) closed
+	// during an operation
+	ErrClosed = errors.New("w5100: socket closed")
+)
@@ -0,0 +1,9 @@
+package w5100
+
+// SetLine replaces the INT pin of the dispatcher (see AttachPin)
+func (d *Dispatcher) SetLine(line func() bool) {
+	d.line = line
+}
+
+// Checksum is the internet checksum of the echo messages
+var Checksum = checksum
@@ -0,0 +1,3 @@
+module github.com/asiffer/arduigo/w5100
+
+go 1.22
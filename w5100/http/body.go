@@ -0,0 +1,254 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Errors returned by the package
+var (
+	// ErrLineTooLong is returned when a request line, status line or
+	// header field does not fit in the read buffer
+	ErrLineTooLong = errors.New("http: line too long")
+	// ErrMalformed is returned when a message cannot be parsed
+	ErrMalformed = errors.New("http: malformed message")
+	// ErrTooManyHeaders is returned when a message has more than
+	// MaxHeaders header fields
+	ErrTooManyHeaders = errors.New("http: too many header fields")
+	// ErrUnsupportedEncoding is returned when the transfer encoding
+	// of a body is not chunked
+	ErrUnsupportedEncoding = errors.New("http: unsupported transfer encoding")
+	// ErrBodyNotAllowed is returned when writing the body of a
+	// response which cannot have one
+	ErrBodyNotAllowed = errors.New("http: response status does not allow a body")
+	// ErrContentLength is returned when writing more than the
+	// declared Content-Length
+	ErrContentLength = errors.New("http: wrote more than the declared Content-Length")
+)
+
+// readLine returns the next line without its CRLF. The line is only
+// valid until the next read.
+func readLine(r *bufio.Reader) ([]uint8, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, ErrLineTooLong
+	}
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+// readHeader reads the header fields until the empty line. When
+// there are more than MaxHeaders fields, the whole header is read
+// but ErrTooManyHeaders is returned. The framing fields of a full
+// header take the place of the last other field, so that the body
+// can still be read.
+func readHeader(r *bufio.Reader, h *Header) error {
+	h.Reset()
+	var overflow error
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 {
+			return overflow
+		}
+		colon := -1
+		for i, c := range line {
+			if c == ':' {
+				colon = i
+				break
+			}
+			if c == ' ' || c == '\t' {
+				// obsolete line folding or space before the colon
+				return ErrMalformed
+			}
+		}
+		if colon <= 0 {
+			return ErrMalformed
+		}
+		name := string(line[:colon])
+		if h.Len() == MaxHeaders {
+			overflow = ErrTooManyHeaders
+			if !isFraming(name) || !h.dropOther() {
+				continue
+			}
+		}
+		h.Add(name, string(trimSpace(line[colon+1:])))
+	}
+}
+
+// trimSpace removes the leading and trailing spaces and tabs
+func trimSpace(b []uint8) []uint8 {
+	for len(b) > 0 && (b[0] == ' ' || b[0] == '\t') {
+		b = b[1:]
+	}
+	for len(b) > 0 && (b[len(b)-1] == ' ' || b[len(b)-1] == '\t') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// body framing
+const (
+	bodyNone    = iota // no body
+	bodyFixed          // Content-Length bytes
+	bodyChunked        // chunked transfer encoding
+	bodyEOF            // until the connection is closed (responses only)
+)
+
+// Body streams the body of a message from the connection. It
+// handles the Content-Length and the chunked transfer encoding.
+type Body struct {
+	r         *bufio.Reader
+	mode      int
+	remaining int64 // bytes left (whole body or current chunk)
+	inChunk   bool  // a chunk has been started
+	err       error // sticky error (io.EOF at the end)
+}
+
+// reset prepares the body for a new message
+func (b *Body) reset(r *bufio.Reader, mode int, length int64) {
+	*b = Body{r: r, mode: mode, remaining: length}
+	if mode == bodyChunked {
+		b.remaining = 0
+	}
+	if mode == bodyNone || (mode == bodyFixed && length == 0) {
+		b.err = io.EOF
+	}
+}
+
+// framing returns the body mode given by the header. It returns
+// -1 as length when it is unknown.
+func framing(h *Header) (int, int64, error) {
+	if te := h.Get("Transfer-Encoding"); te != "" {
+		if !h.contains("Transfer-Encoding", "chunked") {
+			return 0, 0, ErrUnsupportedEncoding
+		}
+		return bodyChunked, -1, nil
+	}
+	n, ok := h.contentLength()
+	if !ok {
+		return 0, 0, ErrMalformed
+	}
+	if n < 0 {
+		return bodyNone, -1, nil
+	}
+	return bodyFixed, n, nil
+}
+
+// Read reads the body. It returns io.EOF at the end of the body.
+func (b *Body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	switch b.mode {
+	case bodyEOF:
+		n, err := b.r.Read(p)
+		if err != nil {
+			b.err = err
+		}
+		return n, err
+	case bodyChunked:
+		if b.remaining == 0 {
+			if err := b.nextChunk(); err != nil {
+				b.err = err
+				return 0, err
+			}
+		}
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if err == io.EOF {
+		// the connection ended before the body
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		b.err = err
+		return n, err
+	}
+	if b.mode == bodyFixed && b.remaining == 0 {
+		b.err = io.EOF
+	}
+	return n, nil
+}
+
+// nextChunk reads the size of the next chunk (and the end of the
+// previous one). It returns io.EOF after the last chunk.
+func (b *Body) nextChunk() error {
+	if b.inChunk {
+		line, err := readLine(b.r)
+		if err != nil {
+			return err
+		}
+		if len(line) != 0 {
+			return ErrMalformed
+		}
+	}
+	line, err := readLine(b.r)
+	if err != nil {
+		return err
+	}
+	// drop the chunk extensions
+	for i, c := range line {
+		if c == ';' {
+			line = line[:i]
+			break
+		}
+	}
+	size, err := strconv.ParseUint(string(trimSpace(line)), 16, 63)
+	if err != nil {
+		return ErrMalformed
+	}
+	if size == 0 {
+		// skip the trailer fields
+		for {
+			line, err := readLine(b.r)
+			if err != nil {
+				return err
+			}
+			if len(line) == 0 {
+				return io.EOF
+			}
+		}
+	}
+	b.remaining = int64(size)
+	b.inChunk = true
+	return nil
+}
+
+// drain reads and drops at most limit bytes of the remaining body.
+// It returns false if the body does not end within the limit or
+// cannot be read.
+func (b *Body) drain(limit int64) bool {
+	var buf [64]uint8
+	for limit >= 0 {
+		n, err := b.Read(buf[:])
+		limit -= int64(n)
+		if err == io.EOF {
+			return limit >= 0
+		}
+		if err != nil {
+			return false
+		}
+	}
+	return false
+}
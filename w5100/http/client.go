@@ -0,0 +1,300 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/dns"
+)
+
+var (
+	// ErrUnsupportedScheme is returned for the URLs which are not
+	// http:// (TLS is not supported)
+	ErrUnsupportedScheme = errors.New("http: unsupported URL scheme")
+	// ErrNoResolver is returned when the host of the URL is a name
+	// and the client has no resolver
+	ErrNoResolver = errors.New("http: no resolver for the host name")
+)
+
+// Client sends requests on a new TCP connection each, which is
+// closed with the response
+type Client struct {
+	wiznet *w5100.W5100
+	// Resolver resolves the host names (only dotted addresses can
+	// be used when it is nil)
+	Resolver *dns.Resolver
+	// Timeout bounds the whole exchange, from the connection to
+	// the end of the response body (0 means no limit)
+	Timeout time.Duration
+	// BufferSize is the size of the read and write buffers, which
+	// bounds the status line and the header fields of the response
+	BufferSize int
+	// UserAgent is sent in the User-Agent field if not empty
+	UserAgent string
+}
+
+// NewClient returns a client using the resolver for the host names
+func NewClient(w *w5100.W5100, resolver *dns.Resolver) *Client {
+	return &Client{
+		wiznet:     w,
+		Resolver:   resolver,
+		Timeout:    30 * time.Second,
+		BufferSize: DefaultBufferSize,
+		UserAgent:  "arduigo-w5100",
+	}
+}
+
+// Response is the response to a request. It must be closed once
+// the body is read (which closes the connection).
+type Response struct {
+	// Status is the status code (e.g. 200)
+	Status int
+	// Proto is the protocol version of the server
+	Proto string
+	// Header holds the header fields (the fields beyond MaxHeaders
+	// are dropped, except the framing fields such as
+	// Transfer-Encoding)
+	Header Header
+	// ContentLength is the length of the body (-1 if unknown)
+	ContentLength int64
+	// Body streams the body from the connection
+	Body *Body
+
+	conn *w5100.Conn
+	body Body
+}
+
+// Close closes the connection of the response
+func (resp *Response) Close() error {
+	if resp.conn == nil {
+		return nil
+	}
+	err := resp.conn.Close()
+	resp.conn = nil
+	return err
+}
+
+// Get sends a GET request
+func (c *Client) Get(ctx context.Context, rawURL string) (*Response, error) {
+	return c.Do(ctx, "GET", rawURL, nil, nil)
+}
+
+// Post sends a POST request with the body. When the length of the
+// body is not known (bytes.Reader, strings.Reader and bytes.Buffer
+// give it), it is sent with the chunked transfer encoding.
+func (c *Client) Post(ctx context.Context, rawURL, contentType string, body io.Reader) (*Response, error) {
+	var h Header
+	h.Set("Content-Type", contentType)
+	return c.Do(ctx, "POST", rawURL, &h, body)
+}
+
+// Do sends a request with the (optional) header fields and body
+// and returns the response once its header is received
+func (c *Client) Do(ctx context.Context, method, rawURL string, header *Header, body io.Reader) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" {
+		return nil, ErrUnsupportedScheme
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	conn, err := c.dial(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+	resp, err := c.exchange(conn, method, u, header, body)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// dial connects to the host of the URL
+func (c *Client) dial(ctx context.Context, u *url.URL) (*w5100.Conn, error) {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+	if c.Resolver != nil {
+		return c.Resolver.Dial(ctx, u.Hostname()+":"+port)
+	}
+
+	ip, err := netip.ParseAddr(u.Hostname())
+	if err != nil || !ip.Is4() {
+		return nil, ErrNoResolver
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 {
+		return nil, w5100.ErrInvalidPort
+	}
+	sock, err := c.wiznet.Open(w5100.Mode.TCP, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	addr := ip.As4()
+	if err := sock.ConnectContext(ctx, addr[:], uint16(p)); err != nil {
+		sock.Close()
+		return nil, err
+	}
+	return w5100.NewConn(sock), nil
+}
+
+// bufferSize returns the size of the connection buffers
+func (c *Client) bufferSize() int {
+	if c.BufferSize <= 0 {
+		return DefaultBufferSize
+	}
+	return c.BufferSize
+}
+
+// bodyLength returns the length of the body if it is known
+func bodyLength(body io.Reader) int64 {
+	if body == nil {
+		return 0
+	}
+	if l, ok := body.(interface{ Len() int }); ok {
+		return int64(l.Len())
+	}
+	return -1
+}
+
+// exchange writes the request and reads the header of the response
+func (c *Client) exchange(conn *w5100.Conn, method string, u *url.URL, header *Header, body io.Reader) (*Response, error) {
+	bw := bufio.NewWriterSize(conn, c.bufferSize())
+	length := bodyLength(body)
+
+	bw.WriteString(method)
+	bw.WriteString(" ")
+	bw.WriteString(u.RequestURI())
+	bw.WriteString(" HTTP/1.1\r\nHost: ")
+	bw.WriteString(u.Host)
+	bw.WriteString("\r\n")
+	if c.UserAgent != "" {
+		bw.WriteString("User-Agent: ")
+		bw.WriteString(c.UserAgent)
+		bw.WriteString("\r\n")
+	}
+	bw.WriteString("Connection: close\r\n")
+	switch {
+	case length > 0 || (length == 0 && body != nil):
+		bw.WriteString("Content-Length: ")
+		bw.WriteString(strconv.FormatInt(length, 10))
+		bw.WriteString("\r\n")
+	case length < 0:
+		bw.WriteString("Transfer-Encoding: chunked\r\n")
+	}
+	if header != nil {
+		for _, f := range header.Fields() {
+			bw.WriteString(f.Name)
+			bw.WriteString(": ")
+			bw.WriteString(f.Value)
+			bw.WriteString("\r\n")
+		}
+	}
+	bw.WriteString("\r\n")
+
+	if err := writeBody(bw, body, length < 0); err != nil {
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return readResponse(conn, c.bufferSize(), method == "HEAD")
+}
+
+// writeBody sends the body of the request, in chunks if its length
+// is unknown. The buffered writer sends the bodies larger than the
+// Tx memory in several parts.
+func writeBody(bw *bufio.Writer, body io.Reader, chunked bool) error {
+	if body == nil {
+		return nil
+	}
+	if !chunked {
+		_, err := io.Copy(bw, body)
+		return err
+	}
+	var buf [256]uint8
+	for {
+		n, err := body.Read(buf[:])
+		if n > 0 {
+			bw.WriteString(strconv.FormatInt(int64(n), 16))
+			bw.WriteString("\r\n")
+			bw.Write(buf[:n])
+			if _, werr := bw.WriteString("\r\n"); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			_, err = bw.WriteString("0\r\n\r\n")
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readResponse parses the status line and the header fields of the
+// response (skipping the informational responses)
+func readResponse(conn *w5100.Conn, size int, head bool) (*Response, error) {
+	resp := &Response{conn: conn}
+	br := bufio.NewReaderSize(conn, size)
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			return nil, err
+		}
+		proto, rest, _ := strings.Cut(string(line), " ")
+		code, _, _ := strings.Cut(rest, " ")
+		if !strings.HasPrefix(proto, "HTTP/1.") || len(code) != 3 {
+			return nil, ErrMalformed
+		}
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 100 {
+			return nil, ErrMalformed
+		}
+		resp.Proto, resp.Status = proto, status
+
+		err = readHeader(br, &resp.Header)
+		if err != nil && err != ErrTooManyHeaders {
+			return nil, err
+		}
+		if status >= 200 {
+			break
+		}
+	}
+
+	mode, length, err := framing(&resp.Header)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case head || !bodyAllowed(resp.Status):
+		mode, length = bodyNone, 0
+	case mode == bodyNone:
+		// delimited by the end of the connection
+		mode = bodyEOF
+	}
+	resp.ContentLength = length
+	resp.body.reset(br, mode, length)
+	resp.Body = &resp.body
+	return resp, nil
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+// complete tells whether the request (header and body) is whole
+func complete(req string) bool {
+	head, body, ok := strings.Cut(req, "\r\n\r\n")
+	switch {
+	case !ok:
+		return false
+	case strings.Contains(head, "\r\nTransfer-Encoding: chunked\r\n"):
+		return strings.HasSuffix(body, "0\r\n\r\n")
+	}
+	if _, v, ok := strings.Cut(head, "\r\nContent-Length: "); ok {
+		v, _, _ = strings.Cut(v, "\r\n")
+		n, _ := strconv.Atoi(v)
+		return len(body) >= n
+	}
+	return true
+}
+
+// serve is a stand-in for an HTTP server. It waits for the request
+// sent by the client on slot 0 of the chip, answers the response and
+// closes the connection. The request is sent on the channel.
+func serve(chip *emulator.Chip, response string) <-chan string {
+	requests := make(chan string, 1)
+	go func() {
+		defer close(requests)
+		deadline := time.Now().Add(5 * time.Second)
+		var req []uint8
+		for !complete(string(req)) {
+			if time.Now().After(deadline) {
+				return
+			}
+			req = append(req, chip.SentBytes(0)...)
+			runtime.Gosched()
+		}
+		data := []uint8(response)
+		for len(data) > 0 {
+			if time.Now().After(deadline) {
+				return
+			}
+			data = data[chip.Deliver(0, data):]
+			runtime.Gosched()
+		}
+		chip.RemoteClose(0)
+		requests <- string(req)
+	}()
+	return requests
+}
+
+// do sends the request to the stand-in and returns the request it
+// received with the response and its whole body
+func do(t *testing.T, response, method string, body io.Reader) (string, *Response, string) {
+	t.Helper()
+	chip := emulator.New()
+	requests := serve(chip, response)
+	c := NewClient(w5100.New(chip), nil)
+	c.Timeout = 5 * time.Second
+	c.UserAgent = ""
+	resp, err := c.Do(context.Background(), method, "http://10.0.0.1:8080/path?q=1", nil, body)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	return <-requests, resp, string(b)
+}
+
+func TestClientContentLength(t *testing.T) {
+	req, resp, body := do(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", "GET", nil)
+	if req != "GET /path?q=1 HTTP/1.1\r\nHost: 10.0.0.1:8080\r\nConnection: close\r\n\r\n" {
+		t.Errorf("request %q", req)
+	}
+	if resp.Status != 200 || resp.Proto != "HTTP/1.1" || resp.ContentLength != 5 || body != "hello" {
+		t.Errorf("response %d %s (%d): %q", resp.Status, resp.Proto, resp.ContentLength, body)
+	}
+}
+
+func TestClientChunked(t *testing.T) {
+	_, resp, body := do(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n4\r\nbody\r\n3\r\n!!!\r\n0\r\n\r\n", "GET", nil)
+	if resp.ContentLength != -1 || body != "body!!!" {
+		t.Errorf("body (%d): %q", resp.ContentLength, body)
+	}
+}
+
+func TestClientCloseDelimited(t *testing.T) {
+	_, resp, body := do(t, "HTTP/1.0 200 OK\r\n\r\nuntil the end", "GET", nil)
+	if resp.ContentLength != -1 || body != "until the end" {
+		t.Errorf("body (%d): %q", resp.ContentLength, body)
+	}
+}
+
+func TestClientFullHeader(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 200 OK\r\n")
+	for i := 0; i < MaxHeaders; i++ {
+		fmt.Fprintf(&b, "X-%d: v\r\n", i)
+	}
+	b.WriteString("Transfer-Encoding: chunked\r\n\r\n4\r\nbody\r\n0\r\n\r\n")
+	_, resp, body := do(t, b.String(), "GET", nil)
+	if body != "body" {
+		t.Errorf("body %q", body)
+	}
+	if resp.Header.Len() != MaxHeaders || resp.Header.Has("X-15") || !resp.Header.Has("X-14") {
+		t.Errorf("header %v", resp.Header.Fields())
+	}
+}
+
+func TestClientInformational(t *testing.T) {
+	_, resp, body := do(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nLink: </style.css>\r\n\r\n"+
+		"HTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok", "POST", strings.NewReader("x"))
+	if resp.Status != 201 || resp.Header.Has("Link") || body != "ok" {
+		t.Errorf("response %d %v: %q", resp.Status, resp.Header.Fields(), body)
+	}
+}
+
+func TestClientChunkedPost(t *testing.T) {
+	// a MultiReader does not give its length
+	body := io.MultiReader(strings.NewReader("abc"), strings.NewReader("de"))
+	req, _, _ := do(t, "HTTP/1.1 204 No Content\r\n\r\n", "POST", body)
+	if !strings.Contains(req, "\r\nTransfer-Encoding: chunked\r\n") || strings.Contains(req, "Content-Length") {
+		t.Errorf("request header %q", req)
+	}
+	if !strings.HasSuffix(req, "\r\n\r\n3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n") {
+		t.Errorf("request body %q", req)
+	}
+}
+
+func TestClientLargeBody(t *testing.T) {
+	data := make([]uint8, 5000)
+	for i := range data {
+		data[i] = uint8(i * 7)
+	}
+	req, resp, _ := do(t, "HTTP/1.1 204 No Content\r\n\r\n", "PUT", bytes.NewReader(data))
+	_, got, _ := strings.Cut(req, "\r\n\r\n")
+	if !strings.Contains(req, "\r\nContent-Length: 5000\r\n") || got != string(data) {
+		t.Errorf("received %d bytes of body", len(got))
+	}
+	if resp.Status != 204 || resp.ContentLength != 0 {
+		t.Errorf("response %d (%d)", resp.Status, resp.ContentLength)
+	}
+}
@@ -0,0 +1,32 @@
+// Package http implements a small HTTP/1.1 server and client on top
+// of the W5100 TCP sockets. It does not depend on net/http so that it can be
+// built with tinygo: the lines are parsed in bounded buffers, the
+// header fields are stored in fixed arrays and a single goroutine
+// serves all the connections of a listener.
+//
+// # Examples
+//
+// The handlers are registered on a router
+//
+//	mux := http.NewMux()
+//	mux.HandleFunc("GET", "/temperature", func(w *http.ResponseWriter, r *http.Request) {
+//		w.Header().Set("Content-Type", "application/json")
+//		fmt.Fprintf(w, `{"celsius": %d}`, sensor.Read())
+//	})
+//	mux.HandleFunc("POST", "/led", func(w *http.ResponseWriter, r *http.Request) {
+//		led.Set(r.Query("on") == "1")
+//		w.WriteHeader(http.StatusNoContent)
+//	})
+//
+// and served on slots 0 to 2 of the chip
+//
+//	err := http.ListenAndServe(ctx, w, 80, mux, 0, 1, 2)
+//
+// The client resolves the host names with a DNS resolver and
+// streams the response body
+//
+//	client := http.NewClient(w, dns.NewResolver(w, dhcpClient.DNS()))
+//	resp, err := client.Post(ctx, "http://api.example.com/readings", "application/json", strings.NewReader(reading))
+//	defer resp.Close()
+//	_, err = io.Copy(os.Stdout, resp.Body)
+package http
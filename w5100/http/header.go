@@ -0,0 +1,152 @@
+package http
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MaxHeaders is the maximum number of header fields kept for
+// a request or a response (the next ones are ignored)
+const MaxHeaders = 16
+
+// Field is a header field
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Header is a bounded list of header fields. The names are compared
+// case-insensitively.
+type Header struct {
+	fields [MaxHeaders]Field
+	n      int
+}
+
+// Len returns the number of fields
+func (h *Header) Len() int {
+	return h.n
+}
+
+// Fields returns the fields in their order of arrival
+func (h *Header) Fields() []Field {
+	return h.fields[:h.n]
+}
+
+// index returns the position of the first field with the name
+func (h *Header) index(name string) int {
+	for i := 0; i < h.n; i++ {
+		if strings.EqualFold(h.fields[i].Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the value of the first field with the name (empty if
+// there is none)
+func (h *Header) Get(name string) string {
+	if i := h.index(name); i >= 0 {
+		return h.fields[i].Value
+	}
+	return ""
+}
+
+// Has tells whether a field with the name is present
+func (h *Header) Has(name string) bool {
+	return h.index(name) >= 0
+}
+
+// Add appends a field. It returns false when the header is full.
+func (h *Header) Add(name, value string) bool {
+	if h.n == MaxHeaders {
+		return false
+	}
+	h.fields[h.n] = Field{Name: name, Value: value}
+	h.n++
+	return true
+}
+
+// Set replaces the value of the field with the name (or adds it).
+// It returns false when the header is full.
+func (h *Header) Set(name, value string) bool {
+	if i := h.index(name); i >= 0 {
+		h.fields[i].Value = value
+		return true
+	}
+	return h.Add(name, value)
+}
+
+// Del removes the fields with the name
+func (h *Header) Del(name string) {
+	n := 0
+	for i := 0; i < h.n; i++ {
+		if !strings.EqualFold(h.fields[i].Name, name) {
+			h.fields[n] = h.fields[i]
+			n++
+		}
+	}
+	for i := n; i < h.n; i++ {
+		h.fields[i] = Field{}
+	}
+	h.n = n
+}
+
+// isFraming tells whether the field delimits the body of a message
+func isFraming(name string) bool {
+	return strings.EqualFold(name, "Transfer-Encoding") ||
+		strings.EqualFold(name, "Content-Length") ||
+		strings.EqualFold(name, "Connection")
+}
+
+// dropOther removes the last field which is not a framing field. It
+// returns false if there is none.
+func (h *Header) dropOther() bool {
+	for i := h.n - 1; i >= 0; i-- {
+		if isFraming(h.fields[i].Name) {
+			continue
+		}
+		copy(h.fields[i:h.n], h.fields[i+1:h.n])
+		h.n--
+		h.fields[h.n] = Field{}
+		return true
+	}
+	return false
+}
+
+// Reset removes all the fields
+func (h *Header) Reset() {
+	for i := 0; i < h.n; i++ {
+		h.fields[i] = Field{}
+	}
+	h.n = 0
+}
+
+// contains tells whether the comma separated list of the field
+// contains the token (e.g. Connection: keep-alive, Upgrade)
+func (h *Header) contains(name, token string) bool {
+	for i := 0; i < h.n; i++ {
+		if !strings.EqualFold(h.fields[i].Name, name) {
+			continue
+		}
+		for _, v := range strings.Split(h.fields[i].Value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contentLength parses the Content-Length field. It returns -1 if it
+// is absent and false if it is malformed.
+func (h *Header) contentLength() (int64, bool) {
+	v := h.Get("Content-Length")
+	if v == "" {
+		return -1, true
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
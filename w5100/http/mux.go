@@ -0,0 +1,109 @@
+package http
+
+import "strings"
+
+// Handler answers a request
+type Handler interface {
+	ServeHTTP(w *ResponseWriter, r *Request)
+}
+
+// HandlerFunc turns a function into a Handler
+type HandlerFunc func(w *ResponseWriter, r *Request)
+
+// ServeHTTP calls f(w, r)
+func (f HandlerFunc) ServeHTTP(w *ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// route maps a method and a path pattern to a handler
+type route struct {
+	method  string
+	pattern string
+	handler Handler
+}
+
+// match tells whether the pattern matches the path. A pattern
+// ending with a slash matches all the paths below it.
+func (rt *route) match(path string) bool {
+	if strings.HasSuffix(rt.pattern, "/") {
+		return strings.HasPrefix(path, rt.pattern)
+	}
+	return path == rt.pattern
+}
+
+// Mux is a router dispatching the requests to the handler of the
+// most specific pattern. It replies 404 when no pattern matches the
+// path and 405 when the method is not handled.
+type Mux struct {
+	routes []route
+}
+
+// NewMux returns an empty router
+func NewMux() *Mux {
+	return &Mux{}
+}
+
+// Handle registers the handler for the method and the pattern. An
+// empty method matches all the methods and the GET handlers also
+// answer the HEAD requests. A pattern ending with a slash (e.g.
+// "/static/") matches the whole subtree, the others match a single
+// path.
+func (m *Mux) Handle(method, pattern string, handler Handler) {
+	m.routes = append(m.routes, route{method: method, pattern: pattern, handler: handler})
+}
+
+// HandleFunc registers the function for the method and the pattern
+func (m *Mux) HandleFunc(method, pattern string, f func(w *ResponseWriter, r *Request)) {
+	m.Handle(method, pattern, HandlerFunc(f))
+}
+
+// allows tells whether the route accepts the method
+func (rt *route) allows(method string) bool {
+	return rt.method == "" || rt.method == method || (method == "HEAD" && rt.method == "GET")
+}
+
+// ServeHTTP dispatches the request
+func (m *Mux) ServeHTTP(w *ResponseWriter, r *Request) {
+	var best *route
+	found := false // the path matches a route (whatever the method)
+	for i := range m.routes {
+		rt := &m.routes[i]
+		if !rt.match(r.Path) {
+			continue
+		}
+		found = true
+		if !rt.allows(r.Method) {
+			continue
+		}
+		if best == nil || len(rt.pattern) > len(best.pattern) ||
+			(len(rt.pattern) == len(best.pattern) && rt.method == r.Method) {
+			best = rt
+		}
+	}
+
+	switch {
+	case best != nil:
+		best.handler.ServeHTTP(w, r)
+	case found:
+		w.Header().Set("Allow", m.allowed(r.Path))
+		Error(w, StatusText(StatusMethodNotAllowed), StatusMethodNotAllowed)
+	default:
+		Error(w, StatusText(StatusNotFound), StatusNotFound)
+	}
+}
+
+// allowed returns the methods handled for the path
+func (m *Mux) allowed(path string) string {
+	var b strings.Builder
+	for i := range m.routes {
+		rt := &m.routes[i]
+		if !rt.match(path) || rt.method == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(rt.method)
+	}
+	return b.String()
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bufio"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Request is a request received by the server. It is reused for
+// the following requests, so the handlers must not keep it (or its
+// body) after returning.
+type Request struct {
+	// Method is the request method (GET, POST...)
+	Method string
+	// Target is the request target as sent by the client
+	Target string
+	// Path is the (escaped) path of the target
+	Path string
+	// RawQuery is the (escaped) query of the target, without '?'
+	RawQuery string
+	// Proto is the protocol version ("HTTP/1.1" or "HTTP/1.0")
+	Proto string
+	// Header holds the header fields
+	Header Header
+	// ContentLength is the length of the body (-1 if unknown)
+	ContentLength int64
+	// Body streams the body of the request. It returns io.EOF
+	// right away if the request has none.
+	Body *Body
+	// RemoteAddr is the address of the client
+	RemoteAddr net.Addr
+
+	body  Body
+	close bool // the client asked to close the connection
+}
+
+// Query returns the (unescaped) value of the first query parameter
+// with the key
+func (r *Request) Query(key string) string {
+	q := r.RawQuery
+	for q != "" {
+		var kv string
+		kv, q, _ = strings.Cut(q, "&")
+		k, v, _ := strings.Cut(kv, "=")
+		if k, err := url.QueryUnescape(k); err != nil || k != key {
+			continue
+		}
+		if v, err := url.QueryUnescape(v); err == nil {
+			return v
+		}
+		return ""
+	}
+	return ""
+}
+
+// isHTTP11 tells whether the request uses HTTP/1.1
+func (r *Request) isHTTP11() bool {
+	return r.Proto == "HTTP/1.1"
+}
+
+// protocolError is a request which cannot be served. The status is
+// sent back to the client before closing the connection.
+type protocolError struct {
+	status int
+	err    error
+}
+
+func (e *protocolError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(status int, err error) error {
+	return &protocolError{status: status, err: err}
+}
+
+// read parses the request line and the header fields. The
+// body is not read.
+func (r *Request) read(br *bufio.Reader) error {
+	line, err := readLine(br)
+	if err == ErrLineTooLong {
+		return badRequest(StatusURITooLong, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	method, rest, ok1 := strings.Cut(string(line), " ")
+	target, proto, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 || method == "" || target == "" {
+		return badRequest(StatusBadRequest, ErrMalformed)
+	}
+	switch proto {
+	case "HTTP/1.1", "HTTP/1.0":
+	default:
+		if strings.HasPrefix(proto, "HTTP/") {
+			return badRequest(StatusVersionNotSupported, ErrMalformed)
+		}
+		return badRequest(StatusBadRequest, ErrMalformed)
+	}
+	if target[0] != '/' && target != "*" {
+		return badRequest(StatusBadRequest, ErrMalformed)
+	}
+	r.Method, r.Target, r.Proto = method, target, proto
+	r.Path, r.RawQuery, _ = strings.Cut(target, "?")
+
+	switch err := readHeader(br, &r.Header); err {
+	case nil:
+	case ErrLineTooLong, ErrTooManyHeaders:
+		return badRequest(StatusHeaderTooLarge, err)
+	case ErrMalformed:
+		return badRequest(StatusBadRequest, err)
+	default:
+		return err
+	}
+	if r.isHTTP11() && !r.Header.Has("Host") {
+		return badRequest(StatusBadRequest, ErrMalformed)
+	}
+
+	mode, length, err := framing(&r.Header)
+	switch err {
+	case nil:
+	case ErrUnsupportedEncoding:
+		return badRequest(StatusNotImplemented, err)
+	default:
+		return badRequest(StatusBadRequest, err)
+	}
+	if mode == bodyNone {
+		length = 0
+	}
+	r.ContentLength = length
+	r.body.reset(br, mode, length)
+	r.Body = &r.body
+
+	if r.isHTTP11() {
+		r.close = r.Header.contains("Connection", "close")
+	} else {
+		r.close = !r.Header.contains("Connection", "keep-alive")
+	}
+	return nil
+}
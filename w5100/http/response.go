@@ -0,0 +1,207 @@
+package http
+
+import (
+	"bufio"
+	"strconv"
+)
+
+// ResponseWriter builds the response of a handler. The header is
+// sent on the first call to WriteHeader or Write. Without a
+// Content-Length field, the body of HTTP/1.1 responses is sent with
+// the chunked transfer encoding (HTTP/1.0 connections are closed
+// after the body instead, as well as when the header has no room
+// left for the Transfer-Encoding field).
+type ResponseWriter struct {
+	w           *bufio.Writer
+	header      Header
+	status      int
+	wroteHeader bool
+	http11      bool  // the request uses HTTP/1.1
+	head        bool  // answer to a HEAD request (no body)
+	noBody      bool  // the status or the method excludes a body
+	chunked     bool  // the body is chunked
+	remaining   int64 // bytes left of the declared Content-Length (-1 none)
+	close       bool  // the connection is closed after the response
+	err         error // first write error
+}
+
+// reset prepares the writer for the response to the request
+func (rw *ResponseWriter) reset(w *bufio.Writer, r *Request) {
+	*rw = ResponseWriter{
+		w:         w,
+		http11:    r.isHTTP11(),
+		head:      r.Method == "HEAD",
+		remaining: -1,
+		close:     r.close,
+	}
+}
+
+// Header returns the header fields to send. They must be set
+// before calling WriteHeader or Write.
+func (rw *ResponseWriter) Header() *Header {
+	return &rw.header
+}
+
+// Status returns the status code sent (0 if the header is not
+// sent yet)
+func (rw *ResponseWriter) Status() int {
+	return rw.status
+}
+
+// writeString writes to the connection and keeps the first error
+func (rw *ResponseWriter) writeString(s string) {
+	if rw.err == nil {
+		_, rw.err = rw.w.WriteString(s)
+	}
+}
+
+// writeInt writes a number in the given base
+func (rw *ResponseWriter) writeInt(n int64, base int) {
+	var buf [20]uint8
+	if rw.err == nil {
+		_, rw.err = rw.w.Write(strconv.AppendInt(buf[:0], n, base))
+	}
+}
+
+// WriteHeader sends the status line and the header fields. The
+// next calls are ignored.
+func (rw *ResponseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	rw.status = code
+
+	h := &rw.header
+	switch {
+	case !bodyAllowed(code) || rw.head:
+		rw.noBody = true
+	default:
+		if n, ok := h.contentLength(); ok && n >= 0 {
+			rw.remaining = n
+			break
+		}
+		h.Del("Content-Length")
+		if rw.http11 && h.Set("Transfer-Encoding", "chunked") {
+			rw.chunked = true
+		} else {
+			// the end of the body is the end of the connection
+			// (also when the header is too full to be chunked)
+			rw.close = true
+		}
+	}
+	if rw.close {
+		h.Set("Connection", "close")
+	} else if !rw.http11 && !h.Set("Connection", "keep-alive") {
+		rw.close = true
+	}
+
+	if rw.http11 {
+		rw.writeString("HTTP/1.1 ")
+	} else {
+		rw.writeString("HTTP/1.0 ")
+	}
+	rw.writeInt(int64(code), 10)
+	rw.writeString(" ")
+	rw.writeString(StatusText(code))
+	rw.writeString("\r\n")
+	for _, f := range h.Fields() {
+		rw.writeString(f.Name)
+		rw.writeString(": ")
+		rw.writeString(f.Value)
+		rw.writeString("\r\n")
+	}
+	rw.writeString("\r\n")
+}
+
+// Write sends a part of the body (the header is sent first with
+// the status 200 if needed)
+func (rw *ResponseWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	if rw.noBody {
+		if rw.head {
+			// the body of a HEAD response is silently dropped
+			return len(p), nil
+		}
+		return 0, ErrBodyNotAllowed
+	}
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	var err error
+	if rw.remaining >= 0 && int64(len(p)) > rw.remaining {
+		p = p[:rw.remaining]
+		err = ErrContentLength
+	}
+	if rw.chunked {
+		rw.writeInt(int64(len(p)), 16)
+		rw.writeString("\r\n")
+	}
+	if rw.err == nil {
+		_, rw.err = rw.w.Write(p)
+	}
+	if rw.chunked {
+		rw.writeString("\r\n")
+	}
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	if rw.remaining >= 0 {
+		rw.remaining -= int64(len(p))
+	}
+	return len(p), err
+}
+
+// WriteString is like Write for a string
+func (rw *ResponseWriter) WriteString(s string) (int, error) {
+	return rw.Write([]byte(s))
+}
+
+// Flush sends the buffered data to the client
+func (rw *ResponseWriter) Flush() error {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	if rw.err == nil {
+		rw.err = rw.w.Flush()
+	}
+	return rw.err
+}
+
+// finish completes the response once the handler has returned
+func (rw *ResponseWriter) finish() error {
+	if !rw.wroteHeader {
+		if !rw.header.Has("Content-Length") && !rw.head {
+			rw.header.Set("Content-Length", "0")
+		}
+		rw.WriteHeader(StatusOK)
+	}
+	if rw.chunked {
+		rw.writeString("0\r\n\r\n")
+	}
+	if rw.remaining > 0 {
+		// the body is shorter than announced, the client can
+		// only recover if the connection is closed
+		rw.close = true
+	}
+	if rw.err == nil {
+		rw.err = rw.w.Flush()
+	}
+	return rw.err
+}
+
+// Error replies with the status and a plain text message
+func Error(w *ResponseWriter, message string, code int) {
+	h := w.Header()
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(len(message)+1))
+	w.WriteHeader(code)
+	w.WriteString(message)
+	w.WriteString("\n")
+}
@@ -0,0 +1,242 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+// Default server settings
+const (
+	// DefaultBufferSize bounds the length of the request line and
+	// of every header field
+	DefaultBufferSize = 512
+	// DefaultMaxDiscard is the size of the unread request body
+	// skipped to keep the connection alive
+	DefaultMaxDiscard = 4096
+)
+
+// serverConn is a client connection served on a slot
+type serverConn struct {
+	conn *w5100.Conn // nil if the entry is free
+	br   *bufio.Reader
+	last time.Time // end of the last request
+}
+
+// Server is an HTTP/1.1 server running in a single goroutine: it
+// accepts the clients on every slot of a listener and serves their
+// requests in turn. Persistent connections (keep-alive) are
+// supported.
+type Server struct {
+	// Handler answers the requests
+	Handler Handler
+	// ReadTimeout is the time allowed to receive the request line
+	// and the header fields once the request has started
+	ReadTimeout time.Duration
+	// WriteTimeout is the time allowed to send the response
+	WriteTimeout time.Duration
+	// IdleTimeout is the time after which an idle persistent
+	// connection is closed (0 means no limit)
+	IdleTimeout time.Duration
+	// BufferSize is the size of the read buffer of every
+	// connection, which bounds the lines of the requests
+	BufferSize int
+	// MaxDiscard is the size of the request body skipped when the
+	// handler does not read it
+	MaxDiscard int64
+
+	conns [w5100.MaxSockNum]serverConn
+	bw    *bufio.Writer
+	req   Request
+	rw    ResponseWriter
+}
+
+// NewServer returns a server with the default settings
+func NewServer(handler Handler) *Server {
+	return &Server{
+		Handler:      handler,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  30 * time.Second,
+		BufferSize:   DefaultBufferSize,
+		MaxDiscard:   DefaultMaxDiscard,
+	}
+}
+
+// ListenAndServe listens on the port (with the given slots, see
+// W5100.Listen) and serves the requests until the context is done
+func ListenAndServe(ctx context.Context, w *w5100.W5100, port uint16, handler Handler, slots ...uint8) error {
+	l, err := w.Listen(port, slots...)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return NewServer(handler).Serve(ctx, l)
+}
+
+// Serve accepts the clients of the listener and serves their requests
+// until the context is done. The open connections are closed when it
+// returns.
+func (s *Server) Serve(ctx context.Context, l *w5100.Listener) error {
+	defer s.closeAll()
+	if s.bw == nil {
+		s.bw = bufio.NewWriterSize(nil, s.bufferSize())
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for i := range s.conns {
+			c := &s.conns[i]
+			if c.conn != nil {
+				continue
+			}
+			conn, err := l.TryAccept()
+			if err != nil {
+				return err
+			}
+			if conn == nil {
+				break
+			}
+			s.attach(c, conn)
+		}
+		for i := range s.conns {
+			if c := &s.conns[i]; c.conn != nil {
+				s.step(c)
+			}
+		}
+	}
+}
+
+// bufferSize returns the size of the connection buffers
+func (s *Server) bufferSize() int {
+	if s.BufferSize <= 0 {
+		return DefaultBufferSize
+	}
+	return s.BufferSize
+}
+
+// attach starts serving a new connection on the entry
+func (s *Server) attach(c *serverConn, conn *w5100.Conn) {
+	if c.br == nil {
+		c.br = bufio.NewReaderSize(conn, s.bufferSize())
+	} else {
+		c.br.Reset(conn)
+	}
+	c.conn = conn
+	c.last = time.Now()
+}
+
+// release closes the connection of the entry
+func (s *Server) release(c *serverConn) {
+	c.conn.Close()
+	c.conn = nil
+	c.br.Reset(nil)
+}
+
+// closeAll closes all the connections
+func (s *Server) closeAll() {
+	for i := range s.conns {
+		if c := &s.conns[i]; c.conn != nil {
+			s.release(c)
+		}
+	}
+}
+
+// deadline returns the deadline for a timeout (zero if unset)
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// step serves the next request of the connection if it has started
+// and closes the idle or closed connections
+func (s *Server) step(c *serverConn) {
+	if c.br.Buffered() == 0 {
+		// check without blocking (nor allocating) whether a
+		// request has started
+		sock := c.conn.Socket()
+		n, err := sock.Available()
+		if err != nil {
+			s.release(c)
+			return
+		}
+		if n == 0 {
+			if sock.Status() != w5100.Status.ESTABLISHED {
+				// closed by the client
+				s.release(c)
+			} else if s.IdleTimeout > 0 && time.Since(c.last) > s.IdleTimeout {
+				s.release(c)
+			}
+			return
+		}
+	}
+
+	if !s.serve(c) {
+		s.release(c)
+		return
+	}
+	c.last = time.Now()
+}
+
+// serve reads a request, calls the handler and sends the response.
+// It returns false if the connection must be closed.
+func (s *Server) serve(c *serverConn) bool {
+	r := &s.req
+	c.conn.SetReadDeadline(deadline(s.ReadTimeout))
+	c.conn.SetWriteDeadline(deadline(s.WriteTimeout))
+	s.bw.Reset(c.conn)
+
+	if err := r.read(c.br); err != nil {
+		var perr *protocolError
+		if errors.As(err, &perr) {
+			s.reject(perr.status)
+		} else if errors.Is(err, w5100.ErrTimeout) {
+			s.reject(StatusRequestTimeout)
+		}
+		return false
+	}
+	r.RemoteAddr = c.conn.RemoteAddr()
+	// the body is read without deadline by the handler
+	c.conn.SetReadDeadline(time.Time{})
+
+	if r.ContentLength != 0 && r.Header.contains("Expect", "100-continue") && r.isHTTP11() {
+		s.bw.WriteString("HTTP/1.1 100 Continue\r\n\r\n")
+		if s.bw.Flush() != nil {
+			return false
+		}
+	}
+
+	rw := &s.rw
+	rw.reset(s.bw, r)
+	s.Handler.ServeHTTP(rw, r)
+	if rw.finish() != nil || rw.close {
+		return false
+	}
+
+	// skip what the handler did not read so that the next request
+	// starts at the right place
+	c.conn.SetReadDeadline(deadline(s.ReadTimeout))
+	return r.body.drain(s.maxDiscard())
+}
+
+// maxDiscard returns the limit of the skipped body
+func (s *Server) maxDiscard() int64 {
+	if s.MaxDiscard <= 0 {
+		return DefaultMaxDiscard
+	}
+	return s.MaxDiscard
+}
+
+// reject answers a request which cannot be parsed
+func (s *Server) reject(status int) {
+	rw := &s.rw
+	rw.reset(s.bw, &Request{Proto: "HTTP/1.1", close: true})
+	Error(rw, StatusText(status), status)
+	rw.finish()
+}
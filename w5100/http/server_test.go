@@ -0,0 +1,182 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+// testServer serves a single connection accepted on slot 0 of an
+// emulated chip, one step at a time
+type testServer struct {
+	t    *testing.T
+	chip *emulator.Chip
+	s    *Server
+	c    *serverConn
+}
+
+func newTestServer(t *testing.T, handler Handler) *testServer {
+	t.Helper()
+	chip := emulator.New()
+	w := w5100.New(chip)
+	l, err := w.Listen(80, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chip.Accept(0, [4]uint8{192, 168, 1, 20}, 51000)
+	conn, err := l.TryAccept()
+	if conn == nil || err != nil {
+		t.Fatalf("TryAccept: %v, %v", conn, err)
+	}
+	s := NewServer(handler)
+	s.bw = bufio.NewWriterSize(nil, s.bufferSize())
+	ts := &testServer{t: t, chip: chip, s: s, c: &s.conns[0]}
+	s.attach(ts.c, conn)
+	return ts
+}
+
+// roundTrip delivers the data to the server, lets it serve and
+// returns what it sent back
+func (ts *testServer) roundTrip(data string) string {
+	ts.t.Helper()
+	if n := ts.chip.Deliver(0, []uint8(data)); n != len(data) {
+		ts.t.Fatalf("delivered %d bytes out of %d", n, len(data))
+	}
+	ts.s.step(ts.c)
+	return string(ts.chip.SentBytes(0))
+}
+
+// open tells whether the server keeps the connection
+func (ts *testServer) open() bool {
+	return ts.c.conn != nil
+}
+
+func testMux() *Mux {
+	mux := NewMux()
+	mux.HandleFunc("GET", "/hello", func(rw *ResponseWriter, r *Request) {
+		fmt.Fprintf(rw, "hello %s", r.Query("name"))
+	})
+	mux.HandleFunc("POST", "/echo", func(rw *ResponseWriter, r *Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(rw, err.Error(), StatusBadRequest)
+			return
+		}
+		rw.Header().Set("Content-Length", fmt.Sprint(len(b)))
+		rw.Write(b)
+	})
+	mux.HandleFunc("POST", "/ignore", func(rw *ResponseWriter, r *Request) {
+		rw.WriteHeader(StatusNoContent)
+	})
+	return mux
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	ts := newTestServer(t, testMux())
+	for _, tc := range []struct{ query, body string }{
+		{"a", "7\r\nhello a\r\n0\r\n\r\n"},
+		{"w%20orld", "c\r\nhello w orld\r\n0\r\n\r\n"},
+	} {
+		got := ts.roundTrip("GET /hello?name=" + tc.query + " HTTP/1.1\r\nHost: x\r\n\r\n")
+		if want := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" + tc.body; got != want {
+			t.Errorf("response %q, want %q", got, want)
+		}
+		if !ts.open() {
+			t.Fatal("keep-alive connection closed")
+		}
+	}
+}
+
+func TestServerBody(t *testing.T) {
+	ts := newTestServer(t, testMux())
+	got := ts.roundTrip("POST /echo HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello")
+	if got != "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello" {
+		t.Errorf("fixed body: %q", got)
+	}
+	got = ts.roundTrip("POST /echo HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n")
+	if got != "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nabcde" {
+		t.Errorf("chunked body: %q", got)
+	}
+	// the unread body is skipped before the next request
+	ts.roundTrip("POST /ignore HTTP/1.1\r\nHost: x\r\nContent-Length: 4\r\n\r\nskip")
+	got = ts.roundTrip("GET /hello?name=b HTTP/1.1\r\nHost: x\r\n\r\n")
+	if !strings.HasSuffix(got, "hello b\r\n0\r\n\r\n") || !ts.open() {
+		t.Errorf("after an unread body: %q", got)
+	}
+}
+
+func TestServerHTTP10(t *testing.T) {
+	ts := newTestServer(t, testMux())
+	got := ts.roundTrip("GET /hello?name=c HTTP/1.0\r\n\r\n")
+	if got != "HTTP/1.0 200 OK\r\nConnection: close\r\n\r\nhello c" {
+		t.Errorf("response %q", got)
+	}
+	if ts.open() {
+		t.Error("close-delimited response without closing")
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	ts := newTestServer(t, testMux())
+	got := ts.roundTrip("DELETE /hello HTTP/1.1\r\nHost: x\r\n\r\n")
+	if !strings.HasPrefix(got, "HTTP/1.1 405 Method Not Allowed\r\nAllow: GET\r\n") {
+		t.Errorf("405: %q", got)
+	}
+	got = ts.roundTrip("GET /nope HTTP/1.1\r\nHost: x\r\n\r\n")
+	if !strings.HasPrefix(got, "HTTP/1.1 404 Not Found\r\n") || !ts.open() {
+		t.Errorf("404: %q", got)
+	}
+	got = ts.roundTrip("GET /hello HTTP/1.1\r\n\r\n")
+	if !strings.HasPrefix(got, "HTTP/1.1 400 Bad Request\r\n") || ts.open() {
+		t.Errorf("missing Host: %q", got)
+	}
+	if ts.chip.Status(0) != w5100.Status.LISTEN {
+		t.Errorf("slot not re-armed: status %#x", ts.chip.Status(0))
+	}
+}
+
+func TestServerClientClose(t *testing.T) {
+	ts := newTestServer(t, testMux())
+	ts.s.step(ts.c)
+	if !ts.open() {
+		t.Fatal("idle connection closed")
+	}
+	ts.chip.RemoteClose(0)
+	ts.s.step(ts.c)
+	if ts.open() {
+		t.Error("connection kept after the client left")
+	}
+}
+
+func TestServerIdleNoAlloc(t *testing.T) {
+	ts := newTestServer(t, testMux())
+	allocs := testing.AllocsPerRun(100, func() {
+		ts.s.step(ts.c)
+	})
+	if allocs != 0 || !ts.open() {
+		t.Errorf("idle step: %v allocations", allocs)
+	}
+}
+
+func TestServerFullHeader(t *testing.T) {
+	mux := NewMux()
+	mux.HandleFunc("GET", "/full", func(rw *ResponseWriter, r *Request) {
+		for i := 0; i < MaxHeaders; i++ {
+			rw.Header().Add(fmt.Sprintf("X-%d", i), "v")
+		}
+		rw.WriteString("body")
+	})
+	ts := newTestServer(t, mux)
+	got := ts.roundTrip("GET /full HTTP/1.1\r\nHost: x\r\n\r\n")
+	if strings.Contains(got, "Transfer-Encoding") || !strings.HasSuffix(got, "X-15: v\r\n\r\nbody") {
+		t.Errorf("response %q", got)
+	}
+	if ts.open() {
+		t.Error("close-delimited response without closing")
+	}
+}
@@ -0,0 +1,80 @@
+package http
+
+// HTTP status codes used by the package
+const (
+	StatusContinue            = 100
+	StatusOK                  = 200
+	StatusCreated             = 201
+	StatusNoContent           = 204
+	StatusMovedPermanently    = 301
+	StatusFound               = 302
+	StatusNotModified         = 304
+	StatusBadRequest          = 400
+	StatusUnauthorized        = 401
+	StatusForbidden           = 403
+	StatusNotFound            = 404
+	StatusMethodNotAllowed    = 405
+	StatusRequestTimeout      = 408
+	StatusLengthRequired      = 411
+	StatusRequestEntityTooBig = 413
+	StatusURITooLong          = 414
+	StatusHeaderTooLarge      = 431
+	StatusInternalServerError = 500
+	StatusNotImplemented      = 501
+	StatusServiceUnavailable  = 503
+	StatusVersionNotSupported = 505
+)
+
+// StatusText returns the reason phrase of the status code
+func StatusText(code int) string {
+	switch code {
+	case StatusContinue:
+		return "Continue"
+	case StatusOK:
+		return "OK"
+	case StatusCreated:
+		return "Created"
+	case StatusNoContent:
+		return "No Content"
+	case StatusMovedPermanently:
+		return "Moved Permanently"
+	case StatusFound:
+		return "Found"
+	case StatusNotModified:
+		return "Not Modified"
+	case StatusBadRequest:
+		return "Bad Request"
+	case StatusUnauthorized:
+		return "Unauthorized"
+	case StatusForbidden:
+		return "Forbidden"
+	case StatusNotFound:
+		return "Not Found"
+	case StatusMethodNotAllowed:
+		return "Method Not Allowed"
+	case StatusRequestTimeout:
+		return "Request Timeout"
+	case StatusLengthRequired:
+		return "Length Required"
+	case StatusRequestEntityTooBig:
+		return "Request Entity Too Large"
+	case StatusURITooLong:
+		return "URI Too Long"
+	case StatusHeaderTooLarge:
+		return "Request Header Fields Too Large"
+	case StatusInternalServerError:
+		return "Internal Server Error"
+	case StatusNotImplemented:
+		return "Not Implemented"
+	case StatusServiceUnavailable:
+		return "Service Unavailable"
+	case StatusVersionNotSupported:
+		return "HTTP Version Not Supported"
+	}
+	return "Status"
+}
+
+// bodyAllowed tells whether a response with the status can have a body
+func bodyAllowed(code int) bool {
+	return code >= 200 && code != StatusNoContent && code != StatusNotModified
+}
@@ -0,0 +1,208 @@
+package w5100
+
+import "sync/atomic"
+
+// SetInterruptMask sets the IMR register: the INT pin is asserted
+// for the bits of IR which are also set in the mask
+func (w *W5100) SetInterruptMask(mask uint8) {
+	w.write(IMR, mask)
+}
+
+// GetInterruptMask returns the IMR register
+func (w *W5100) GetInterruptMask() uint8 {
+	return w.read(IMR)
+}
+
+// EnableSocketInterrupt enables (or disables) the INT pin for the
+// events of the socket
+func (w *W5100) EnableSocketInterrupt(id uint8, enable bool) error {
+	if id >= MaxSockNum {
+		return ErrInvalidSocket
+	}
+	mask := w.read(IMR)
+	if enable {
+		mask |= 1 << id
+	} else {
+		mask &^= 1 << id
+	}
+	w.write(IMR, mask)
+	return nil
+}
+
+// GetInterrupts returns the IR register
+func (w *W5100) GetInterrupts() uint8 {
+	return w.read(IR)
+}
+
+// Event is a set of socket interrupts delivered by a Dispatcher
+type Event struct {
+	// Socket is the socket id
+	Socket uint8
+	// Flags are the SnIR bits (see Interrupt)
+	Flags uint8
+	// Status is the SnSR register when the event was read
+	Status uint8
+}
+
+// Has tells whether the event contains the interrupt (see Interrupt)
+func (e Event) Has(flag uint8) bool {
+	return e.Flags&flag != 0
+}
+
+// listener receives the events of a socket
+type listener struct {
+	mask    uint8
+	handler func(Event)
+	ch      chan<- Event
+}
+
+// Dispatcher reads the interrupt registers once and delivers the
+// socket events (CON, DISCON, RECV, TIMEOUT, SEND_OK) to the
+// registered callbacks or channels. Only the SnIR bits of the
+// registered masks are cleared, so that the blocking calls (Send,
+// SendTo, Connect) still see the bits they wait for.
+//
+// The INT pin of the chip is asserted when an enabled event
+// occurs: with a pin interrupt calling Trigger (or with AttachPin),
+// Dispatch does not even read the registers while nothing happens.
+type Dispatcher struct {
+	wiznet    *W5100
+	listeners [MaxSockNum]listener
+
+	conflict    func()
+	unreachable func(ip []uint8, port uint16)
+
+	triggered atomic.Bool
+	line      func() bool // tells whether the INT pin is asserted
+}
+
+// NewDispatcher returns a dispatcher without any listener
+func (w *W5100) NewDispatcher() *Dispatcher {
+	return &Dispatcher{wiznet: w}
+}
+
+// Handle registers the callback for the events of the socket. Only
+// the interrupts of the mask (e.g. Interrupt.RECV|Interrupt.DISCON)
+// are delivered and cleared. It enables the socket interrupt (IMR).
+func (d *Dispatcher) Handle(id uint8, mask uint8, handler func(Event)) error {
+	if id >= MaxSockNum {
+		return ErrInvalidSocket
+	}
+	d.listeners[id] = listener{mask: mask, handler: handler}
+	return d.wiznet.EnableSocketInterrupt(id, true)
+}
+
+// Notify is like Handle but the events are sent to the channel. An
+// event is dropped if the channel is full.
+func (d *Dispatcher) Notify(id uint8, mask uint8, ch chan<- Event) error {
+	if id >= MaxSockNum {
+		return ErrInvalidSocket
+	}
+	d.listeners[id] = listener{mask: mask, ch: ch}
+	return d.wiznet.EnableSocketInterrupt(id, true)
+}
+
+// Remove unregisters the listener of the socket and disables its
+// interrupt
+func (d *Dispatcher) Remove(id uint8) error {
+	if id >= MaxSockNum {
+		return ErrInvalidSocket
+	}
+	d.listeners[id] = listener{}
+	return d.wiznet.EnableSocketInterrupt(id, false)
+}
+
+// HandleConflict registers the callback called when another host
+// uses the IP address of the chip
+func (d *Dispatcher) HandleConflict(handler func()) {
+	d.conflict = handler
+	d.setCommon(IR_CONFLICT, handler != nil)
+}
+
+// HandleUnreachable registers the callback called when an ICMP
+// destination unreachable message is received for a datagram
+func (d *Dispatcher) HandleUnreachable(handler func(ip []uint8, port uint16)) {
+	d.unreachable = handler
+	d.setCommon(IR_UNREACH, handler != nil)
+}
+
+// setCommon enables or disables a common interrupt
+func (d *Dispatcher) setCommon(bit uint8, enable bool) {
+	mask := d.wiznet.read(IMR)
+	if enable {
+		mask |= bit
+	} else {
+		mask &^= bit
+	}
+	d.wiznet.write(IMR, mask)
+}
+
+// Trigger marks the interrupt as pending. It is safe to call from
+// an interrupt handler (e.g. on the falling edge of the INT pin).
+func (d *Dispatcher) Trigger() {
+	d.triggered.Store(true)
+}
+
+// Pending tells whether Dispatch may have events to deliver. It is
+// always true unless a pin is attached or Trigger is used.
+func (d *Dispatcher) Pending() bool {
+	if d.triggered.Load() {
+		return true
+	}
+	if d.line != nil {
+		return d.line()
+	}
+	return true
+}
+
+// Dispatch reads IR (and the SnIR of the flagged sockets) once and
+// delivers the events. It returns the number of delivered events.
+func (d *Dispatcher) Dispatch() int {
+	if !d.Pending() {
+		return 0
+	}
+	d.triggered.Store(false)
+
+	w := d.wiznet
+	ir := w.read(IR)
+	count := 0
+	if ir&IR_CONFLICT != 0 {
+		w.write(IR, IR_CONFLICT)
+		if d.conflict != nil {
+			d.conflict()
+			count++
+		}
+	}
+	if ir&IR_UNREACH != 0 {
+		w.write(IR, IR_UNREACH)
+		if d.unreachable != nil {
+			d.unreachable(w.readBuffer(UIPR, 4), w.read16(UPORT))
+			count++
+		}
+	}
+
+	for id := uint8(0); id < MaxSockNum; id++ {
+		l := &d.listeners[id]
+		if ir&(1<<id) == 0 || l.mask == 0 {
+			continue
+		}
+		sock := CH_BASE + uint16(id)*CH_SIZE
+		flags := w.read(sock+SocketRegister.IR) & l.mask
+		if flags == 0 {
+			continue
+		}
+		w.write(sock+SocketRegister.IR, flags)
+		e := Event{Socket: id, Flags: flags, Status: w.read(sock + SocketRegister.SR)}
+		switch {
+		case l.handler != nil:
+			l.handler(e)
+		case l.ch != nil:
+			select {
+			case l.ch <- e:
+			default:
+			}
+		}
+		count++
+	}
+	return count
+}
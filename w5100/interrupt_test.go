@@ -0,0 +1,172 @@
+package w5100_test
+
+import (
+	"testing"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+// sendHook is a bus running a function once the SEND command of the
+// socket is written, i.e. while the host waits for SEND_OK
+type sendHook struct {
+	*emulator.Chip
+	id    uint8
+	frame []uint8
+	hook  func()
+}
+
+func (b *sendHook) Select() {
+	b.frame = b.frame[:0]
+	b.Chip.Select()
+}
+
+func (b *sendHook) Transfer(data uint8) uint8 {
+	b.frame = append(b.frame, data)
+	return b.Chip.Transfer(data)
+}
+
+func (b *sendHook) Deselect() {
+	b.Chip.Deselect()
+	cr := w5100.CH_BASE + uint16(b.id)*w5100.CH_SIZE + w5100.SocketRegister.CR
+	f := b.frame
+	if b.hook == nil || len(f) != 4 || f[0] != w5100.WRITE || uint16(f[1])<<8|uint16(f[2]) != cr || f[3] != w5100.Command.SEND {
+		return
+	}
+	hook := b.hook
+	b.hook = nil
+	hook()
+}
+
+func TestDispatcherMask(t *testing.T) {
+	chip := emulator.New()
+	bus := &sendHook{Chip: chip, id: 1}
+	w := w5100.New(bus)
+	sock, _ := w.Socket(1, w5100.Mode.TCP, 80, 0)
+	sock.Listen()
+	chip.Accept(1, peer, 51000)
+	chip.Deliver(1, []uint8("hello"))
+
+	d := w.NewDispatcher()
+	var events []w5100.Event
+	d.Handle(1, w5100.Interrupt.RECV|w5100.Interrupt.DISCON, func(e w5100.Event) {
+		events = append(events, e)
+	})
+	if w.GetInterruptMask() != 1<<1 {
+		t.Errorf("IMR %#x", w.GetInterruptMask())
+	}
+	// the events are dispatched while Send waits for SEND_OK
+	bus.hook = func() { d.Dispatch() }
+	if n := sock.Send([]uint8("x")); n != 1 {
+		t.Fatalf("sent %d bytes", n)
+	}
+	if bus.hook != nil {
+		t.Fatal("nothing dispatched during Send")
+	}
+	if len(events) != 1 || events[0].Flags != w5100.Interrupt.RECV || events[0].Socket != 1 || events[0].Status != w5100.Status.ESTABLISHED {
+		t.Errorf("events %+v", events)
+	}
+	// CON is not in the mask
+	ir := chip.Read(w5100.CH_BASE + w5100.CH_SIZE + w5100.SocketRegister.IR)
+	if ir != w5100.Interrupt.CON {
+		t.Errorf("SnIR %#x", ir)
+	}
+	if n := d.Dispatch(); n != 0 {
+		t.Errorf("%d events dispatched again", n)
+	}
+}
+
+func TestDispatcherNotify(t *testing.T) {
+	chip, w, sock := connected(t, 2)
+	d := w.NewDispatcher()
+	ch := make(chan w5100.Event, 1)
+	d.Notify(2, w5100.Interrupt.RECV, ch)
+
+	chip.Deliver(2, []uint8("a"))
+	if n := d.Dispatch(); n != 1 || len(ch) != 1 {
+		t.Fatalf("dispatched %d events", n)
+	}
+	sock.Recv(1)
+	chip.Deliver(2, []uint8("b"))
+	// the channel is full, the event is dropped without blocking
+	if n := d.Dispatch(); n != 1 || len(ch) != 1 {
+		t.Errorf("dispatched %d events, %d queued", n, len(ch))
+	}
+	if e := <-ch; !e.Has(w5100.Interrupt.RECV) || e.Socket != 2 {
+		t.Errorf("event %+v", e)
+	}
+	if chip.Read(w5100.CH_BASE+2*w5100.CH_SIZE+w5100.SocketRegister.IR)&w5100.Interrupt.RECV != 0 {
+		t.Error("RECV not cleared")
+	}
+
+	d.Remove(2)
+	chip.Deliver(2, []uint8("c"))
+	if n := d.Dispatch(); n != 0 || len(ch) != 0 || w.GetInterruptMask() != 0 {
+		t.Errorf("removed listener: %d events, IMR %#x", n, w.GetInterruptMask())
+	}
+}
+
+func TestDispatcherCommon(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	d := w.NewDispatcher()
+	conflicts := 0
+	var unreachable []uint8
+	var port uint16
+	d.HandleConflict(func() { conflicts++ })
+	d.HandleUnreachable(func(ip []uint8, p uint16) { unreachable, port = ip, p })
+	if w.GetInterruptMask() != w5100.IR_CONFLICT|w5100.IR_UNREACH {
+		t.Errorf("IMR %#x", w.GetInterruptMask())
+	}
+
+	chip.Conflict()
+	chip.Unreachable([4]uint8{10, 0, 0, 9}, 5353)
+	if n := d.Dispatch(); n != 2 {
+		t.Errorf("dispatched %d events", n)
+	}
+	if conflicts != 1 || string(unreachable) != string([]uint8{10, 0, 0, 9}) || port != 5353 {
+		t.Errorf("conflicts %d, unreachable %v:%d", conflicts, unreachable, port)
+	}
+	if ir := w.GetInterrupts(); ir != 0 {
+		t.Errorf("IR %#x", ir)
+	}
+
+	// the bits are cleared without handler
+	d.HandleConflict(nil)
+	chip.Conflict()
+	if n := d.Dispatch(); n != 0 || w.GetInterrupts() != 0 || conflicts != 1 {
+		t.Errorf("conflict without handler: %d events, IR %#x", n, w.GetInterrupts())
+	}
+	if w.GetInterruptMask() != w5100.IR_UNREACH {
+		t.Errorf("IMR %#x", w.GetInterruptMask())
+	}
+}
+
+func TestDispatcherPending(t *testing.T) {
+	chip, w, _ := connected(t, 0)
+	d := w.NewDispatcher()
+	count := 0
+	d.Handle(0, w5100.Interrupt.RECV, func(w5100.Event) { count++ })
+	if !d.Pending() {
+		t.Error("not pending without pin")
+	}
+
+	asserted := false
+	d.SetLine(func() bool { return asserted })
+	chip.Deliver(0, []uint8("x"))
+	if d.Pending() || d.Dispatch() != 0 || count != 0 {
+		t.Fatal("dispatched while the pin is released")
+	}
+	d.Trigger()
+	if !d.Pending() || d.Dispatch() != 1 || count != 1 {
+		t.Fatal("trigger ignored")
+	}
+	// the trigger is consumed by Dispatch
+	if d.Pending() {
+		t.Error("still pending after Dispatch")
+	}
+	asserted = true
+	if !d.Pending() {
+		t.Error("not pending while the pin is asserted")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build tinygo
+
+package w5100
+
+import "machine"
+
+// AttachPin configures the pin wired to the INT output of the chip
+// (active low). Dispatch then reads the registers only while the
+// pin is low. Where the target supports pin interrupts, Trigger can
+// also be called from the interrupt handler to wake the main loop:
+//
+//	pin.SetInterrupt(machine.PinFalling, func(machine.Pin) { d.Trigger() })
+func (d *Dispatcher) AttachPin(pin machine.Pin) {
+	pin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	d.line = func() bool {
+		return !pin.Get()
+	}
+}
@@ -0,0 +1,159 @@
+package w5100
+
+import "net"
+
+// Listener is a TCP server owning one or several socket slots
+// listening on the same port. Established connections are
+// returned by Accept and their slot is re-armed once closed: the
+// slots stay reserved for the listener until it is closed.
+type Listener struct {
+	wiznet  *W5100
+	port    uint16
+	slots   []uint8
+	sockets []*Socket // armed socket of every slot
+	served  []bool    // the slot is handed out to a connection
+	next    int       // slot to check first (round robin)
+	closed  bool
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// Listen opens a TCP server on the given port. Every slot (socket id)
+// is armed in LISTEN mode so that up to len(slots) clients can be
+// served concurrently. A free slot is allocated if none is given.
+func (w *W5100) Listen(port uint16, slots ...uint8) (*Listener, error) {
+	if port == 0 {
+		return nil, ErrInvalidPort
+	}
+	if len(slots) == 0 {
+		slot, err := w.freeSlot(Mode.TCP)
+		if err != nil {
+			return nil, err
+		}
+		slots = []uint8{slot}
+	}
+	if len(slots) > MaxSockNum {
+		return nil, ErrInvalidSocket
+	}
+
+	l := &Listener{
+		wiznet:  w,
+		port:    port,
+		slots:   slots,
+		sockets: make([]*Socket, len(slots)),
+		served:  make([]bool, len(slots)),
+	}
+	for i := range slots {
+		if err := l.arm(i); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// arm opens a fresh socket in LISTEN mode on the i-th slot. A slot
+// which still belongs to the listener is open again without being
+// released, so that Open cannot take it meanwhile.
+func (l *Listener) arm(i int) error {
+	var sock *Socket
+	var err error
+	if prev := l.sockets[i]; prev != nil && prev.owned() {
+		sock, err = l.wiznet.open(l.slots[i], Mode.TCP, l.port, 0)
+	} else {
+		sock, err = l.wiznet.Socket(l.slots[i], Mode.TCP, l.port, 0)
+	}
+	if err != nil {
+		return err
+	}
+	l.sockets[i] = sock
+	l.served[i] = false
+	return sock.Listen()
+}
+
+// poll checks every slot once. It returns an established connection
+// if any and re-arms the slots that are closed.
+func (l *Listener) poll() (*Conn, error) {
+	for k := range l.slots {
+		i := (l.next + k) % len(l.slots)
+		if l.served[i] {
+			// the connection is still in use until closed (which
+			// re-arms the slot), unless its socket was closed
+			// directly, releasing the slot
+			if l.sockets[i].owned() {
+				continue
+			}
+			// the slot may have been taken by another socket
+			if err := l.arm(i); err != nil && err != ErrSocketBusy {
+				return nil, err
+			}
+			continue
+		}
+
+		switch l.sockets[i].read(SocketRegister.SR) {
+		case Status.LISTEN, Status.SYNRECV:
+			// waiting for a client
+		case Status.ESTABLISHED, Status.CLOSE_WAIT:
+			l.served[i] = true
+			l.next = (i + 1) % len(l.slots)
+			conn := NewConn(l.sockets[i])
+			conn.listener, conn.index = l, i
+			return conn, nil
+		default:
+			// closed by the chip (timeout...)
+			if err := l.arm(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Accept waits for a client and returns the established connection
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		if l.closed {
+			return nil, net.ErrClosed
+		}
+		conn, err := l.poll()
+		if err != nil {
+			return nil, err
+		}
+		if conn != nil {
+			return conn, nil
+		}
+	}
+}
+
+// TryAccept returns an established connection if a client is
+// waiting and nil otherwise. It never blocks, so that a single
+// goroutine can accept clients while serving the other ones.
+func (l *Listener) TryAccept() (*Conn, error) {
+	if l.closed {
+		return nil, net.ErrClosed
+	}
+	return l.poll()
+}
+
+// Close stops listening. The connections already returned by
+// Accept are not closed.
+func (l *Listener) Close() error {
+	if l.closed {
+		return net.ErrClosed
+	}
+	l.closed = true
+	for i, sock := range l.sockets {
+		if sock != nil && !l.served[i] {
+			sock.Close()
+		}
+	}
+	return nil
+}
+
+// Addr returns the address of the server
+func (l *Listener) Addr() net.Addr {
+	return &net.TCPAddr{
+		IP:   net.IP(l.wiznet.GetIPAddress()),
+		Port: int(l.port),
+	}
+}
@@ -0,0 +1,68 @@
+package w5100_test
+
+import (
+	"testing"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+// TestListenerKeepsSlots checks that a slot freed by a connection
+// goes back to the listener, not to a socket opened meanwhile
+func TestListenerKeepsSlots(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	l, err := w.Listen(80, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for round := 0; round < 3; round++ {
+		chip.Accept(0, peer, 51000+uint16(round))
+		conn, err := l.TryAccept()
+		if conn == nil || err != nil {
+			t.Fatalf("round %d: TryAccept: %v, %v", round, conn, err)
+		}
+		if err := conn.Close(); err != nil {
+			t.Fatalf("round %d: Close: %v", round, err)
+		}
+		if chip.Status(0) != w5100.Status.LISTEN {
+			t.Fatalf("round %d: slot not re-armed: status %#x", round, chip.Status(0))
+		}
+		sock, err := w.Open(w5100.Mode.UDP, 5000, 0)
+		if err != nil {
+			t.Fatalf("round %d: Open: %v", round, err)
+		}
+		if sock.ID() == 0 {
+			t.Fatalf("round %d: Open took the slot of the listener", round)
+		}
+		sock.Close()
+	}
+
+	l.Close()
+	if chip.Status(0) != w5100.Status.CLOSED {
+		t.Errorf("Close: status %#x", chip.Status(0))
+	}
+	if _, err := w.Socket(0, w5100.Mode.TCP, 80, 0); err != nil {
+		t.Errorf("slot not released: %v", err)
+	}
+}
+
+// TestListenerConnClosedAfter checks that a connection closed after
+// its listener releases the slot
+func TestListenerConnClosedAfter(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	l, _ := w.Listen(80, 2)
+	chip.Accept(2, peer, 51000)
+	conn, _ := l.TryAccept()
+	l.Close()
+	if chip.Status(2) != w5100.Status.ESTABLISHED {
+		t.Fatal("Close closed the served connection")
+	}
+	conn.Close()
+	if _, err := w.Socket(2, w5100.Mode.TCP, 80, 0); err != nil {
+		t.Errorf("slot not released: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build tinygo
+
+package w5100
+
+import "machine"
+
+// spiTransferer is the byte transfer method shared by
+// every machine.SPI implementation of tinygo
+type spiTransferer interface {
+	Transfer(w byte) (byte, error)
+}
+
+// MachineSPI adapts a tinygo machine.SPI (already configured
+// in mode 0, MSB first) and a chip select pin to the Bus interface
+type MachineSPI struct {
+	SPI spiTransferer
+	CS  machine.Pin
+}
+
+// NewMachineSPI creates the adapter and configures the chip select pin
+func NewMachineSPI(spi spiTransferer, cs machine.Pin) *MachineSPI {
+	cs.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	cs.High()
+	return &MachineSPI{SPI: spi, CS: cs}
+}
+
+// Select pulls CS low
+func (m *MachineSPI) Select() {
+	m.CS.Low()
+}
+
+// Deselect pulls CS high
+func (m *MachineSPI) Deselect() {
+	m.CS.High()
+}
+
+// Transfer sends a single byte to the SPI bus
+func (m *MachineSPI) Transfer(data uint8) uint8 {
+	// errors are not reported by the W5100 protocol anyway
+	r, _ := m.SPI.Transfer(data)
+	return r
+}
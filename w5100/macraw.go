@@ -0,0 +1,92 @@
+package w5100
+
+import "context"
+
+// MACRAWHeaderSize is the size of the header the W5100 puts in
+// front of every frame received in MACRAW mode: frame length
+// (2 bytes, header included)
+const MACRAWHeaderSize uint16 = 2
+
+// Ethernet frame sizes (without preamble and FCS)
+const (
+	MinFrameSize = 14   // destination, source and EtherType
+	MaxFrameSize = 1514 // header and 1500 bytes of payload
+)
+
+// ReadFrame returns a single Ethernet frame received by a socket
+// opened in MACRAW mode (slot 0). The frame is nil when none is
+// available. When the chip reports a corrupted length, the pending
+// data is dropped and ErrInvalidFrame is returned.
+func (sock *Socket) ReadFrame() ([]uint8, error) {
+	ptr, size, err := sock.frame()
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	frame := sock.readData(ptr, size)
+	return frame, sock.consume(ptr + size)
+}
+
+// ReadFrameInto is like ReadFrame but it copies the frame into the
+// caller buffer (MaxFrameSize bytes fit any frame) instead of
+// allocating one. It returns 0 when no frame is available. When the
+// frame is larger than dst, it is truncated and ErrTruncated is
+// returned.
+func (sock *Socket) ReadFrameInto(dst []uint8) (int, error) {
+	ptr, size, err := sock.frame()
+	if err != nil || size == 0 {
+		return 0, err
+	}
+	n := sock.copyData(ptr, size, dst)
+	if err := sock.consume(ptr + size); err != nil {
+		return n, err
+	}
+	if n < int(size) {
+		return n, ErrTruncated
+	}
+	return n, nil
+}
+
+// frame reads the header of the next frame and returns the pointer
+// to the frame and its length (0 when none is available)
+func (sock *Socket) frame() (uint16, uint16, error) {
+	if sock.read(SocketRegister.SR) != Status.MACRAW {
+		return 0, 0, ErrInvalidMode
+	}
+	received, err := sock.getRXReceivedSize()
+	if err != nil || received < MACRAWHeaderSize {
+		return 0, 0, err
+	}
+
+	var header [MACRAWHeaderSize]uint8
+	ptr := sock.read16(SocketRegister.RxRD)
+	sock.readDataInto(ptr, header[:])
+	size := uint16(header[0])<<8 | uint16(header[1])
+	if size <= MACRAWHeaderSize || size-MACRAWHeaderSize > MaxFrameSize || size > received {
+		// lost synchronization with the frame boundaries
+		if err := sock.consume(ptr + received); err != nil {
+			return 0, 0, err
+		}
+		return 0, 0, ErrInvalidFrame
+	}
+	return ptr + MACRAWHeaderSize, size - MACRAWHeaderSize, nil
+}
+
+// WriteFrame sends a whole Ethernet frame (destination and source
+// MAC addresses, EtherType and payload) through a socket opened in
+// MACRAW mode. The chip appends the FCS.
+func (sock *Socket) WriteFrame(frame []uint8) error {
+	return sock.WriteFrameContext(context.Background(), frame)
+}
+
+// WriteFrameContext is like WriteFrame but it stops waiting when
+// the context is done or the socket timeout is exceeded
+func (sock *Socket) WriteFrameContext(ctx context.Context, frame []uint8) error {
+	if sock.read(SocketRegister.SR) != Status.MACRAW {
+		return ErrInvalidMode
+	}
+	if len(frame) < MinFrameSize || len(frame) > MaxFrameSize {
+		return ErrInvalidFrame
+	}
+	_, err := sock.sendTo(ctx, nil, 0, frame)
+	return err
+}
@@ -0,0 +1,69 @@
+package w5100
+
+// MemorySizes gives the size (in bytes) of the Tx or Rx buffer of
+// every socket. The W5100 shares 8KB of Tx memory and 8KB of Rx memory
+// among the sockets, each one getting 1KB, 2KB, 4KB or 8KB. A socket
+// can get 0 only if the previous ones already take the whole 8KB.
+type MemorySizes [MaxSockNum]uint16
+
+// DefaultMemorySizes is the layout after reset (2KB per socket)
+var DefaultMemorySizes = MemorySizes{2048, 2048, 2048, 2048}
+
+// encode returns the value of the RMSR/TMSR register (2 bits per
+// socket, socket 0 in the least significant bits)
+func (m MemorySizes) encode() (uint8, error) {
+	var msr uint8
+	var total uint16
+	for i, size := range m {
+		var bits uint8
+		switch size {
+		case 0:
+			// the chip gives nothing once the memory is exhausted
+			if total != TxRxMaxBufSize*MaxSockNum {
+				return 0, ErrInvalidMemorySize
+			}
+		case 1024:
+			bits = 0
+		case 2048:
+			bits = 1
+		case 4096:
+			bits = 2
+		case 8192:
+			bits = 3
+		default:
+			return 0, ErrInvalidMemorySize
+		}
+		total += size
+		if total > TxRxMaxBufSize*MaxSockNum {
+			return 0, ErrInvalidMemorySize
+		}
+		msr |= bits << (2 * i)
+	}
+	return msr, nil
+}
+
+// SetMemorySizes shares the Tx and Rx memory among the sockets
+// (TMSR and RMSR registers). It must be called before opening
+// the sockets, e.g. a single socket server can take the whole memory:
+//
+//	w.SetMemorySizes(w5100.MemorySizes{8192}, w5100.MemorySizes{8192})
+func (w *W5100) SetMemorySizes(tx, rx MemorySizes) error {
+	tmsr, err := tx.encode()
+	if err != nil {
+		return err
+	}
+	rmsr, err := rx.encode()
+	if err != nil {
+		return err
+	}
+	w.write(TMSR, tmsr)
+	w.write(RMSR, rmsr)
+	w.txSizes = tx
+	w.rxSizes = rx
+	return nil
+}
+
+// GetMemorySizes returns the current sharing of the Tx and Rx memory
+func (w *W5100) GetMemorySizes() (tx, rx MemorySizes) {
+	return w.txSizes, w.rxSizes
+}
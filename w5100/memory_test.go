@@ -0,0 +1,138 @@
+package w5100_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+func TestSetMemorySizes(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		sizes w5100.MemorySizes
+		msr   uint8
+		err   error
+	}{
+		{"default", w5100.DefaultMemorySizes, 0x55, nil},
+		{"single socket", w5100.MemorySizes{8192, 0, 0, 0}, 0x03, nil},
+		{"two sockets", w5100.MemorySizes{4096, 4096, 0, 0}, 0x0A, nil},
+		{"mixed sizes", w5100.MemorySizes{1024, 1024, 2048, 4096}, 0x90, nil},
+		{"memory left", w5100.MemorySizes{1024, 1024, 1024, 1024}, 0x00, nil},
+
+		{"zero first", w5100.MemorySizes{0, 8192, 0, 0}, 0, w5100.ErrInvalidMemorySize},
+		{"zero before the memory is full", w5100.MemorySizes{4096, 2048, 0, 2048}, 0, w5100.ErrInvalidMemorySize},
+		{"more than 8KB", w5100.MemorySizes{8192, 1024, 0, 0}, 0, w5100.ErrInvalidMemorySize},
+		{"more than 8KB at the end", w5100.MemorySizes{2048, 2048, 2048, 4096}, 0, w5100.ErrInvalidMemorySize},
+		{"not a power of two", w5100.MemorySizes{3000, 1024, 1024, 1024}, 0, w5100.ErrInvalidMemorySize},
+		{"too small", w5100.MemorySizes{512, 2048, 2048, 2048}, 0, w5100.ErrInvalidMemorySize},
+	} {
+		chip := emulator.New()
+		w := w5100.New(chip)
+		err := w.SetMemorySizes(tc.sizes, tc.sizes)
+		if err != tc.err {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.err)
+			continue
+		}
+		gotTx, gotRx := w.GetMemorySizes()
+		if err != nil {
+			// the previous layout is kept
+			if gotTx != w5100.DefaultMemorySizes || chip.Read(w5100.TMSR) != 0x55 || chip.Read(w5100.RMSR) != 0x55 {
+				t.Errorf("%s: layout changed to %v, TMSR %#x", tc.name, gotTx, chip.Read(w5100.TMSR))
+			}
+			// the Rx layout alone is checked as well
+			if err := w.SetMemorySizes(w5100.DefaultMemorySizes, tc.sizes); err != tc.err {
+				t.Errorf("%s: Rx layout: got %v", tc.name, err)
+			}
+			continue
+		}
+		if tmsr := chip.Read(w5100.TMSR); tmsr != tc.msr || gotTx != tc.sizes {
+			t.Errorf("%s: TMSR %#x, want %#x, sizes %v", tc.name, tmsr, tc.msr, gotTx)
+		}
+		if rmsr := chip.Read(w5100.RMSR); rmsr != tc.msr || gotRx != tc.sizes {
+			t.Errorf("%s: RMSR %#x, want %#x, sizes %v", tc.name, rmsr, tc.msr, gotRx)
+		}
+	}
+}
+
+func TestNewWithMemory(t *testing.T) {
+	if w, err := w5100.NewWithMemory(emulator.New(), w5100.MemorySizes{4096, 0}, w5100.DefaultMemorySizes); w != nil || err != w5100.ErrInvalidMemorySize {
+		t.Errorf("invalid layout: %v, %v", w, err)
+	}
+
+	// the slots without memory are skipped by Open
+	chip := emulator.New()
+	half := w5100.MemorySizes{4096, 4096, 0, 0}
+	w, err := w5100.NewWithMemory(chip, half, half)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := w.FreeSockets(); n != 2 {
+		t.Errorf("%d free sockets", n)
+	}
+	for slot := uint8(0); slot < 2; slot++ {
+		sock, err := w.Open(w5100.Mode.UDP, 0, 0)
+		if err != nil || sock.ID() != slot {
+			t.Fatalf("Open: %v", err)
+		}
+		if sock.TxSize() != 4096 || sock.RxSize() != 4096 {
+			t.Errorf("slot %d: Tx %d, Rx %d", slot, sock.TxSize(), sock.RxSize())
+		}
+	}
+	if _, err := w.Open(w5100.Mode.UDP, 0, 0); err != w5100.ErrNoFreeSocket {
+		t.Errorf("third Open: got %v", err)
+	}
+	if _, err := w.Socket(2, w5100.Mode.UDP, 0, 0); err != w5100.ErrNoMemory {
+		t.Errorf("slot 2: got %v", err)
+	}
+	if chip.Status(2) != w5100.Status.CLOSED {
+		t.Errorf("slot 2 open: status %#x", chip.Status(2))
+	}
+}
+
+// TestWholeMemory checks a single socket with the whole 8KB of Tx and
+// Rx memory across the end of the rings
+func TestWholeMemory(t *testing.T) {
+	chip := emulator.New()
+	all := w5100.MemorySizes{8192}
+	w, err := w5100.NewWithMemory(chip, all, all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock, _ := w.Socket(0, w5100.Mode.TCP, 80, 0)
+	sock.Listen()
+	chip.Accept(0, peer, 51000)
+	if sock.TxSize() != 8192 || sock.RxSize() != 8192 {
+		t.Fatalf("Tx %d, Rx %d", sock.TxSize(), sock.RxSize())
+	}
+
+	var sent []uint8
+	for i := 0; i < 4; i++ {
+		msg := make([]uint8, 5000)
+		for j := range msg {
+			msg[j] = uint8(i*31 + j*7)
+		}
+		if n := chip.Deliver(0, msg); n != len(msg) {
+			t.Fatalf("message %d: %d bytes delivered", i, n)
+		}
+		if got := sock.Recv(8192); !bytes.Equal(got, msg) {
+			t.Fatalf("message %d: received %d corrupted bytes", i, len(got))
+		}
+		if n := sock.Send(msg); n != 5000 {
+			t.Fatalf("message %d: sent %d bytes", i, n)
+		}
+		sent = append(sent, msg...)
+	}
+	if !bytes.Equal(chip.SentBytes(0), sent) {
+		t.Error("the peer received corrupted data")
+	}
+	// a single send of the whole memory
+	full := bytes.Repeat([]uint8{0xA5}, 8192)
+	if n := sock.Send(full); n != 8192 {
+		t.Fatalf("sent %d bytes", n)
+	}
+	if p := chip.Sent(0); len(p) != 1 || !bytes.Equal(p[0].Data, full) {
+		t.Errorf("%d packets", len(p))
+	}
+}
@@ -0,0 +1,20 @@
+// Package modbus implements a Modbus TCP server (slave) on the W5100
+// listening sockets. It serves the function codes 1 to 6, 15 and 16
+// against coil and register tables backed by callbacks.
+//
+// # Examples
+//
+// The tables map a range of addresses to the I/O of the board
+//
+//	s := modbus.NewServer()
+//	s.HandleCoils(0, 8, func(addr uint16) (bool, error) {
+//		return relays[addr].Get(), nil
+//	}, func(addr uint16, on bool) error {
+//		relays[addr].Set(on)
+//		return nil
+//	})
+//	s.HandleInputRegisters(0, 4, func(addr uint16) (uint16, error) {
+//		return uint16(machine.ADC{Pin: analog[addr]}.Get()), nil
+//	})
+//	err := s.ListenAndServe(ctx, w, modbus.Port, 0, 1)
+package modbus
@@ -0,0 +1,222 @@
+package modbus
+
+import "encoding/binary"
+
+// Function codes
+const (
+	ReadCoils              uint8 = 0x01
+	ReadDiscreteInputs     uint8 = 0x02
+	ReadHoldingRegisters   uint8 = 0x03
+	ReadInputRegisters     uint8 = 0x04
+	WriteSingleCoil        uint8 = 0x05
+	WriteSingleRegister    uint8 = 0x06
+	WriteMultipleCoils     uint8 = 0x0F
+	WriteMultipleRegisters uint8 = 0x10
+)
+
+// quantity limits of the specification
+const (
+	maxReadBits       = 2000
+	maxReadRegisters  = 125
+	maxWriteBits      = 1968
+	maxWriteRegisters = 123
+)
+
+// coil values of WriteSingleCoil
+const (
+	coilOn  uint16 = 0xFF00
+	coilOff uint16 = 0x0000
+)
+
+// process executes the request PDU and writes the response PDU into
+// resp. It returns the size of the response.
+func (s *Server) process(req []uint8, resp []uint8) int {
+	if len(req) < 1 {
+		return 0
+	}
+	fc := req[0]
+	resp[0] = fc
+	n, exc := s.execute(fc, req[1:], resp[1:])
+	if exc != 0 {
+		resp[0] = fc | 0x80
+		resp[1] = uint8(exc)
+		return 2
+	}
+	return 1 + n
+}
+
+// execute runs the function and returns the size of the response
+// data or an exception
+func (s *Server) execute(fc uint8, data []uint8, out []uint8) (int, Exception) {
+	switch fc {
+	case ReadCoils:
+		return readBits(s.coils, data, out)
+	case ReadDiscreteInputs:
+		return readBits(s.inputs, data, out)
+	case ReadHoldingRegisters:
+		return readRegisters(s.holding, data, out)
+	case ReadInputRegisters:
+		return readRegisters(s.registers, data, out)
+	case WriteSingleCoil:
+		return writeSingleCoil(s.coils, data, out)
+	case WriteSingleRegister:
+		return writeSingleRegister(s.holding, data, out)
+	case WriteMultipleCoils:
+		return writeBits(s.coils, data, out)
+	case WriteMultipleRegisters:
+		return writeRegisters(s.holding, data, out)
+	}
+	return 0, IllegalFunction
+}
+
+// rangeOf decodes the starting address and the quantity of a request
+func rangeOf(data []uint8) (uint16, uint16, bool) {
+	if len(data) < 4 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:]), true
+}
+
+// readBits serves the function codes 1 and 2
+func readBits(tables []bitTable, data []uint8, out []uint8) (int, Exception) {
+	addr, qty, ok := rangeOf(data)
+	if !ok || len(data) != 4 || qty == 0 || qty > maxReadBits {
+		return 0, IllegalDataValue
+	}
+	if uint32(addr)+uint32(qty) > 0x10000 {
+		return 0, IllegalDataAddress
+	}
+	size := (int(qty) + 7) / 8
+	out[0] = uint8(size)
+	for i := 0; i < size; i++ {
+		out[1+i] = 0
+	}
+	for i := uint16(0); i < qty; i++ {
+		t := findBit(tables, addr+i)
+		if t == nil || t.read == nil {
+			return 0, IllegalDataAddress
+		}
+		v, err := t.read(addr + i)
+		if err != nil {
+			return 0, exception(err)
+		}
+		if v {
+			out[1+i/8] |= 1 << (i % 8)
+		}
+	}
+	return 1 + size, 0
+}
+
+// readRegisters serves the function codes 3 and 4
+func readRegisters(tables []registerTable, data []uint8, out []uint8) (int, Exception) {
+	addr, qty, ok := rangeOf(data)
+	if !ok || len(data) != 4 || qty == 0 || qty > maxReadRegisters {
+		return 0, IllegalDataValue
+	}
+	if uint32(addr)+uint32(qty) > 0x10000 {
+		return 0, IllegalDataAddress
+	}
+	out[0] = uint8(2 * qty)
+	for i := uint16(0); i < qty; i++ {
+		t := findRegister(tables, addr+i)
+		if t == nil || t.read == nil {
+			return 0, IllegalDataAddress
+		}
+		v, err := t.read(addr + i)
+		if err != nil {
+			return 0, exception(err)
+		}
+		binary.BigEndian.PutUint16(out[1+2*i:], v)
+	}
+	return 1 + 2*int(qty), 0
+}
+
+// writeSingleCoil serves the function code 5
+func writeSingleCoil(tables []bitTable, data []uint8, out []uint8) (int, Exception) {
+	addr, value, ok := rangeOf(data)
+	if !ok || len(data) != 4 || (value != coilOn && value != coilOff) {
+		return 0, IllegalDataValue
+	}
+	t := findBit(tables, addr)
+	if t == nil || t.write == nil {
+		return 0, IllegalDataAddress
+	}
+	if err := t.write(addr, value == coilOn); err != nil {
+		return 0, exception(err)
+	}
+	// echo of the request
+	return copy(out, data), 0
+}
+
+// writeSingleRegister serves the function code 6
+func writeSingleRegister(tables []registerTable, data []uint8, out []uint8) (int, Exception) {
+	addr, value, ok := rangeOf(data)
+	if !ok || len(data) != 4 {
+		return 0, IllegalDataValue
+	}
+	t := findRegister(tables, addr)
+	if t == nil || t.write == nil {
+		return 0, IllegalDataAddress
+	}
+	if err := t.write(addr, value); err != nil {
+		return 0, exception(err)
+	}
+	return copy(out, data), 0
+}
+
+// writeBits serves the function code 15
+func writeBits(tables []bitTable, data []uint8, out []uint8) (int, Exception) {
+	addr, qty, ok := rangeOf(data)
+	if !ok || len(data) < 5 || qty == 0 || qty > maxWriteBits {
+		return 0, IllegalDataValue
+	}
+	size := int(data[4])
+	if size != (int(qty)+7)/8 || len(data) != 5+size {
+		return 0, IllegalDataValue
+	}
+	if uint32(addr)+uint32(qty) > 0x10000 {
+		return 0, IllegalDataAddress
+	}
+	// check the whole range before writing anything
+	for i := uint16(0); i < qty; i++ {
+		if t := findBit(tables, addr+i); t == nil || t.write == nil {
+			return 0, IllegalDataAddress
+		}
+	}
+	values := data[5:]
+	for i := uint16(0); i < qty; i++ {
+		t := findBit(tables, addr+i)
+		if err := t.write(addr+i, values[i/8]&(1<<(i%8)) != 0); err != nil {
+			return 0, exception(err)
+		}
+	}
+	return copy(out, data[:4]), 0
+}
+
+// writeRegisters serves the function code 16
+func writeRegisters(tables []registerTable, data []uint8, out []uint8) (int, Exception) {
+	addr, qty, ok := rangeOf(data)
+	if !ok || len(data) < 5 || qty == 0 || qty > maxWriteRegisters {
+		return 0, IllegalDataValue
+	}
+	size := int(data[4])
+	if size != 2*int(qty) || len(data) != 5+size {
+		return 0, IllegalDataValue
+	}
+	if uint32(addr)+uint32(qty) > 0x10000 {
+		return 0, IllegalDataAddress
+	}
+	for i := uint16(0); i < qty; i++ {
+		if t := findRegister(tables, addr+i); t == nil || t.write == nil {
+			return 0, IllegalDataAddress
+		}
+	}
+	values := data[5:]
+	for i := uint16(0); i < qty; i++ {
+		t := findRegister(tables, addr+i)
+		if err := t.write(addr+i, binary.BigEndian.Uint16(values[2*i:])); err != nil {
+			return 0, exception(err)
+		}
+	}
+	return copy(out, data[:4]), 0
+}
@@ -0,0 +1,176 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+// Port is the Modbus TCP port
+const Port uint16 = 502
+
+// frame sizes
+const (
+	mbapSize = 7   // transaction, protocol, length and unit identifiers
+	maxPDU   = 253 // function code and data
+	maxADU   = mbapSize + maxPDU
+)
+
+// client is a connection served on a slot. Only the MBAP header is
+// buffered per connection, the PDU is read once the header is
+// complete.
+type client struct {
+	conn   *w5100.Conn // nil if the entry is free
+	header [mbapSize]uint8
+	n      int       // header bytes received
+	last   time.Time // last request
+}
+
+// Server is a Modbus TCP server running in a single goroutine. It
+// accepts the clients on every slot of a listener and answers
+// their requests in turn.
+type Server struct {
+	// UnitID is the unit identifier of the server. When it is not
+	// zero, the requests for the other units (but 0 and 0xFF) are
+	// ignored.
+	UnitID uint8
+	// ReadTimeout is the time allowed to receive the end of a
+	// request once its header is received
+	ReadTimeout time.Duration
+	// IdleTimeout is the time after which a silent connection is
+	// closed (0 means no limit)
+	IdleTimeout time.Duration
+
+	coils     []bitTable
+	inputs    []bitTable
+	holding   []registerTable
+	registers []registerTable
+
+	clients [w5100.MaxSockNum]client
+	req     [maxPDU]uint8 // request PDU
+	buf     [maxADU]uint8 // response
+}
+
+// NewServer returns a server without any table
+func NewServer() *Server {
+	return &Server{ReadTimeout: time.Second, IdleTimeout: time.Minute}
+}
+
+// ListenAndServe listens on the port (with the given slots, see
+// W5100.Listen) and serves the requests until the context is done
+func (s *Server) ListenAndServe(ctx context.Context, w *w5100.W5100, port uint16, slots ...uint8) error {
+	l, err := w.Listen(port, slots...)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts the clients of the listener and answers their
+// requests until the context is done. The open connections are
+// closed when it returns.
+func (s *Server) Serve(ctx context.Context, l *w5100.Listener) error {
+	defer s.closeAll()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for i := range s.clients {
+			c := &s.clients[i]
+			if c.conn != nil {
+				continue
+			}
+			conn, err := l.TryAccept()
+			if err != nil {
+				return err
+			}
+			if conn == nil {
+				break
+			}
+			*c = client{conn: conn, last: time.Now()}
+		}
+		for i := range s.clients {
+			if c := &s.clients[i]; c.conn != nil {
+				s.step(c)
+			}
+		}
+	}
+}
+
+// release closes the connection of the entry
+func (s *Server) release(c *client) {
+	c.conn.Close()
+	c.conn = nil
+}
+
+// closeAll closes all the connections
+func (s *Server) closeAll() {
+	for i := range s.clients {
+		if c := &s.clients[i]; c.conn != nil {
+			s.release(c)
+		}
+	}
+}
+
+// step reads the available part of the header without blocking (nor
+// allocating) and answers the request once the header is complete
+func (s *Server) step(c *client) {
+	n, err := c.conn.Socket().ReadInto(c.header[c.n:])
+	c.n += n
+	if err != nil {
+		// closed by the client
+		s.release(c)
+		return
+	}
+	if c.n < mbapSize {
+		if s.IdleTimeout > 0 && time.Since(c.last) > s.IdleTimeout {
+			s.release(c)
+		}
+		return
+	}
+
+	c.n = 0
+	c.last = time.Now()
+	if !s.serve(c) {
+		s.release(c)
+	}
+}
+
+// serve reads the PDU following the header and sends the response.
+// It returns false if the connection must be closed.
+func (s *Server) serve(c *client) bool {
+	h := c.header[:]
+	protocol := binary.BigEndian.Uint16(h[2:])
+	length := int(binary.BigEndian.Uint16(h[4:]))
+	unit := h[6]
+	if protocol != 0 || length < 2 || length-1 > maxPDU {
+		// not Modbus, the stream cannot be resynchronized
+		return false
+	}
+
+	pdu := s.req[:length-1]
+	if s.ReadTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+	} else {
+		c.conn.SetReadDeadline(time.Time{})
+	}
+	if _, err := io.ReadFull(c.conn, pdu); err != nil {
+		return false
+	}
+	if s.UnitID != 0 && unit != s.UnitID && unit != 0 && unit != 0xFF {
+		return true
+	}
+
+	size := s.process(pdu, s.buf[mbapSize:])
+
+	resp := s.buf[:mbapSize+size]
+	copy(resp, h[:4]) // transaction and protocol identifiers
+	binary.BigEndian.PutUint16(resp[4:], uint16(size+1))
+	resp[6] = unit
+	_, err := c.conn.Write(resp)
+	return err == nil
+}
@@ -0,0 +1,208 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+// device is the I/O image served by the test server
+type device struct {
+	coils   [16]bool
+	inputs  [8]bool
+	holding [10]uint16
+	writes  int
+}
+
+// newDevice returns a server with:
+//   - the coils 0-15 (read-write) and 16-19 (read-only)
+//   - the discrete inputs 0-7
+//   - the holding registers 100-109, 200 (busy) and 201 (failing)
+//   - the input registers 0-3
+func newDevice() (*Server, *device) {
+	d := &device{}
+	d.coils[2], d.coils[4] = true, true
+	d.inputs[1], d.inputs[7] = true, true
+	for i := range d.holding {
+		d.holding[i] = uint16(0x1000 + i)
+	}
+	s := NewServer()
+	s.HandleCoils(0, 16, func(addr uint16) (bool, error) {
+		return d.coils[addr], nil
+	}, func(addr uint16, on bool) error {
+		d.coils[addr] = on
+		d.writes++
+		return nil
+	})
+	s.HandleCoils(16, 4, func(addr uint16) (bool, error) { return true, nil }, nil)
+	s.HandleDiscreteInputs(0, 8, func(addr uint16) (bool, error) {
+		return d.inputs[addr], nil
+	})
+	s.HandleHoldingRegisters(100, 10, func(addr uint16) (uint16, error) {
+		return d.holding[addr-100], nil
+	}, func(addr uint16, v uint16) error {
+		d.holding[addr-100] = v
+		d.writes++
+		return nil
+	})
+	s.HandleHoldingRegisters(200, 1, func(addr uint16) (uint16, error) {
+		return 0, ServerDeviceBusy
+	}, func(addr uint16, v uint16) error {
+		return ServerDeviceBusy
+	})
+	s.HandleHoldingRegisters(201, 1, func(addr uint16) (uint16, error) {
+		return 0, errors.New("sensor unplugged")
+	}, nil)
+	s.HandleInputRegisters(0, 4, func(addr uint16) (uint16, error) {
+		return 500 + addr, nil
+	})
+	return s, d
+}
+
+func TestProcess(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		req, resp []uint8
+	}{
+		{"read coils", []uint8{0x01, 0, 2, 0, 3}, []uint8{0x01, 1, 0x05}},
+		{"read coils over two tables", []uint8{0x01, 0, 14, 0, 4}, []uint8{0x01, 1, 0x0C}},
+		{"read discrete inputs", []uint8{0x02, 0, 0, 0, 8}, []uint8{0x02, 1, 0x82}},
+		{"read holding registers", []uint8{0x03, 0, 101, 0, 2}, []uint8{0x03, 4, 0x10, 0x01, 0x10, 0x02}},
+		{"read input registers", []uint8{0x04, 0, 3, 0, 1}, []uint8{0x04, 2, 0x01, 0xF7}},
+		{"write single coil", []uint8{0x05, 0, 3, 0xFF, 0}, []uint8{0x05, 0, 3, 0xFF, 0}},
+		{"write single register", []uint8{0x06, 0, 109, 0xAB, 0xCD}, []uint8{0x06, 0, 109, 0xAB, 0xCD}},
+		{"write multiple coils", []uint8{0x0F, 0, 4, 0, 10, 2, 0x01, 0x02}, []uint8{0x0F, 0, 4, 0, 10}},
+		{"write multiple registers", []uint8{0x10, 0, 100, 0, 2, 4, 0, 1, 0, 2}, []uint8{0x10, 0, 100, 0, 2}},
+
+		{"unknown function", []uint8{0x2B, 0x0E}, []uint8{0xAB, 0x01}},
+		{"zero quantity", []uint8{0x01, 0, 0, 0, 0}, []uint8{0x81, 0x03}},
+		{"too many coils", []uint8{0x01, 0, 0, 0x07, 0xD1}, []uint8{0x81, 0x03}},
+		{"too many registers", []uint8{0x03, 0, 100, 0, 126}, []uint8{0x83, 0x03}},
+		{"short request", []uint8{0x04, 0, 0, 0}, []uint8{0x84, 0x03}},
+		{"long request", []uint8{0x04, 0, 0, 0, 1, 0}, []uint8{0x84, 0x03}},
+		{"bad coil value", []uint8{0x05, 0, 3, 0x12, 0x34}, []uint8{0x85, 0x03}},
+		{"wrong byte count of coils", []uint8{0x0F, 0, 0, 0, 9, 1, 0xFF}, []uint8{0x8F, 0x03}},
+		{"wrong byte count of registers", []uint8{0x10, 0, 100, 0, 2, 3, 0, 1, 0}, []uint8{0x90, 0x03}},
+		{"missing values", []uint8{0x10, 0, 100, 0, 2, 4, 0, 1}, []uint8{0x90, 0x03}},
+
+		{"unmapped coil", []uint8{0x01, 0, 20, 0, 1}, []uint8{0x81, 0x02}},
+		{"unmapped register", []uint8{0x03, 0, 99, 0, 2}, []uint8{0x83, 0x02}},
+		{"range past the tables", []uint8{0x04, 0, 2, 0, 3}, []uint8{0x84, 0x02}},
+		{"range overflowing the addresses", []uint8{0x03, 0xFF, 0xFF, 0, 2}, []uint8{0x83, 0x02}},
+		{"read-only coil", []uint8{0x05, 0, 16, 0, 0}, []uint8{0x85, 0x02}},
+		{"read-only register", []uint8{0x06, 0, 201, 0, 0}, []uint8{0x86, 0x02}},
+		{"no table for the function", []uint8{0x05, 1, 0, 0, 0}, []uint8{0x85, 0x02}},
+
+		{"exception of a callback", []uint8{0x03, 0, 200, 0, 1}, []uint8{0x83, 0x06}},
+		{"error of a callback", []uint8{0x03, 0, 201, 0, 1}, []uint8{0x83, 0x04}},
+		{"exception of a write callback", []uint8{0x06, 0, 200, 0, 1}, []uint8{0x86, 0x06}},
+	} {
+		s, _ := newDevice()
+		var resp [maxPDU]uint8
+		n := s.process(tc.req, resp[:])
+		if !bytes.Equal(resp[:n], tc.resp) {
+			t.Errorf("%s: % x, want % x", tc.name, resp[:n], tc.resp)
+		}
+	}
+}
+
+func TestProcessWrites(t *testing.T) {
+	s, d := newDevice()
+	var resp [maxPDU]uint8
+	s.process([]uint8{0x0F, 0, 4, 0, 10, 2, 0x03, 0x02}, resp[:])
+	want := [16]bool{2: true, 4: true, 5: true, 13: true}
+	if d.coils != want {
+		t.Errorf("coils %v", d.coils)
+	}
+	s.process([]uint8{0x10, 0, 108, 0, 2, 4, 0xBE, 0xEF, 0xCA, 0xFE}, resp[:])
+	if d.holding[8] != 0xBEEF || d.holding[9] != 0xCAFE {
+		t.Errorf("holding registers %x", d.holding)
+	}
+
+	// the range is checked before writing anything
+	s, d = newDevice()
+	for _, req := range [][]uint8{
+		{0x0F, 0, 14, 0, 4, 1, 0x0F},                     // 16-17 are read-only
+		{0x10, 0, 108, 0, 3, 6, 0, 1, 0, 2, 0, 3},        // 110 is unmapped
+		{0x10, 0, 109, 0, 2, 4, 0, 1, 0, 2},              // 110 is unmapped
+		{0x0F, 0xFF, 0xFF, 0, 2, 1, 0x03},                // past the address space
+		{0x10, 0xFF, 0xFF, 0, 2, 4, 0, 1, 0, 2},          // past the address space
+		{0x0F, 0, 0, 0x07, 0xB1, 0xF7, 0, 0, 0, 0, 0, 0}, // too many coils
+	} {
+		if n := s.process(req, resp[:]); n != 2 || resp[0] != req[0]|0x80 {
+			t.Errorf("% x: % x", req, resp[:n])
+		}
+	}
+	if d.writes != 0 {
+		t.Errorf("%d partial writes", d.writes)
+	}
+}
+
+// exchange delivers the data to the connection on slot 0 and waits
+// for the response of the server
+func exchange(t *testing.T, chip *emulator.Chip, data []uint8) []uint8 {
+	t.Helper()
+	chip.Deliver(0, data)
+	var resp []uint8
+	deadline := time.Now().Add(5 * time.Second)
+	for len(resp) < mbapSize || len(resp) < mbapSize-1+int(resp[4])<<8|int(resp[5]) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no response to % x (% x)", data, resp)
+		}
+		resp = append(resp, chip.SentBytes(0)...)
+		runtime.Gosched()
+	}
+	return resp
+}
+
+func TestServe(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	s, _ := newDevice()
+	s.UnitID = 3
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.ListenAndServe(ctx, w, Port, 0) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Serve: %v", err)
+		}
+	}()
+	for chip.Status(0) != w5100.Status.LISTEN {
+		runtime.Gosched()
+	}
+	chip.Accept(0, [4]uint8{192, 168, 1, 20}, 51000)
+
+	got := exchange(t, chip, []uint8{0x12, 0x34, 0, 0, 0, 6, 3, 0x04, 0, 0, 0, 2})
+	if want := []uint8{0x12, 0x34, 0, 0, 0, 7, 3, 0x04, 4, 0x01, 0xF4, 0x01, 0xF5}; !bytes.Equal(got, want) {
+		t.Errorf("response % x, want % x", got, want)
+	}
+	// the request for another unit is ignored, the broadcast is served
+	got = exchange(t, chip, []uint8{
+		0, 1, 0, 0, 0, 6, 9, 0x04, 0, 0, 0, 1,
+		0, 2, 0, 0, 0, 6, 0, 0x04, 0, 0, 0, 1,
+	})
+	if want := []uint8{0, 2, 0, 0, 0, 5, 0, 0x04, 2, 0x01, 0xF4}; !bytes.Equal(got, want) {
+		t.Errorf("response % x, want % x", got, want)
+	}
+
+	// a wrong protocol identifier closes the connection
+	chip.Deliver(0, []uint8{0, 3, 0, 1, 0, 6, 3, 0x04, 0, 0, 0, 1})
+	deadline := time.Now().Add(5 * time.Second)
+	for chip.Status(0) != w5100.Status.LISTEN {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection kept: status %#x", chip.Status(0))
+		}
+		runtime.Gosched()
+	}
+	if sent := chip.SentBytes(0); len(sent) != 0 {
+		t.Errorf("answered % x", sent)
+	}
+}
@@ -0,0 +1,105 @@
+package modbus
+
+// Exception is a Modbus exception code. The table callbacks can
+// return one to choose the exception sent back to the client (the
+// other errors are reported as ServerDeviceFailure).
+type Exception uint8
+
+// Exception codes
+const (
+	IllegalFunction     Exception = 0x01
+	IllegalDataAddress  Exception = 0x02
+	IllegalDataValue    Exception = 0x03
+	ServerDeviceFailure Exception = 0x04
+	ServerDeviceBusy    Exception = 0x06
+)
+
+func (e Exception) Error() string {
+	switch e {
+	case IllegalFunction:
+		return "modbus: illegal function"
+	case IllegalDataAddress:
+		return "modbus: illegal data address"
+	case IllegalDataValue:
+		return "modbus: illegal data value"
+	case ServerDeviceFailure:
+		return "modbus: server device failure"
+	case ServerDeviceBusy:
+		return "modbus: server device busy"
+	}
+	return "modbus: exception"
+}
+
+// exception converts a callback error
+func exception(err error) Exception {
+	if e, ok := err.(Exception); ok {
+		return e
+	}
+	return ServerDeviceFailure
+}
+
+// bitTable is a range of coils or discrete inputs
+type bitTable struct {
+	start uint16
+	count uint16
+	read  func(addr uint16) (bool, error)
+	write func(addr uint16, value bool) error
+}
+
+// registerTable is a range of holding or input registers
+type registerTable struct {
+	start uint16
+	count uint16
+	read  func(addr uint16) (uint16, error)
+	write func(addr uint16, value uint16) error
+}
+
+// contains tells whether the address is in the range
+func contains(start, count, addr uint16) bool {
+	return addr >= start && uint32(addr) < uint32(start)+uint32(count)
+}
+
+// findBit returns the table of the address (nil if none)
+func findBit(tables []bitTable, addr uint16) *bitTable {
+	for i := range tables {
+		if contains(tables[i].start, tables[i].count, addr) {
+			return &tables[i]
+		}
+	}
+	return nil
+}
+
+// findRegister returns the table of the address (nil if none)
+func findRegister(tables []registerTable, addr uint16) *registerTable {
+	for i := range tables {
+		if contains(tables[i].start, tables[i].count, addr) {
+			return &tables[i]
+		}
+	}
+	return nil
+}
+
+// HandleCoils serves the coils [start, start+count) (function codes
+// 1, 5 and 15). The write callback can be nil for read-only coils.
+func (s *Server) HandleCoils(start, count uint16, read func(addr uint16) (bool, error), write func(addr uint16, value bool) error) {
+	s.coils = append(s.coils, bitTable{start: start, count: count, read: read, write: write})
+}
+
+// HandleDiscreteInputs serves the discrete inputs [start, start+count)
+// (function code 2)
+func (s *Server) HandleDiscreteInputs(start, count uint16, read func(addr uint16) (bool, error)) {
+	s.inputs = append(s.inputs, bitTable{start: start, count: count, read: read})
+}
+
+// HandleHoldingRegisters serves the holding registers
+// [start, start+count) (function codes 3, 6 and 16). The write
+// callback can be nil for read-only registers.
+func (s *Server) HandleHoldingRegisters(start, count uint16, read func(addr uint16) (uint16, error), write func(addr uint16, value uint16) error) {
+	s.holding = append(s.holding, registerTable{start: start, count: count, read: read, write: write})
+}
+
+// HandleInputRegisters serves the input registers [start, start+count)
+// (function code 4)
+func (s *Server) HandleInputRegisters(start, count uint16, read func(addr uint16) (uint16, error)) {
+	s.registers = append(s.registers, registerTable{start: start, count: count, read: read})
+}
@@ -0,0 +1,658 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+var (
+	// ErrNotConnected is returned when the client is not connected
+	// to the broker
+	ErrNotConnected = errors.New("mqtt: not connected")
+	// ErrPacketTooLarge is returned when a packet does not fit in
+	// MaxPacketSize bytes
+	ErrPacketTooLarge = errors.New("mqtt: packet too large")
+	// ErrInvalidTopic is returned when a topic name or filter is
+	// empty or has misplaced wildcards
+	ErrInvalidTopic = errors.New("mqtt: invalid topic")
+	// ErrInvalidQoS is returned for QoS greater than 1
+	ErrInvalidQoS = errors.New("mqtt: unsupported QoS")
+	// ErrTooManySubscriptions is returned when MaxSubscriptions
+	// filters are already subscribed
+	ErrTooManySubscriptions = errors.New("mqtt: too many subscriptions")
+	// ErrSubscribeFailed is returned when the broker refuses
+	// a subscription
+	ErrSubscribeFailed = errors.New("mqtt: subscription refused")
+	// ErrProtocol is returned when the broker sends an unexpected packet
+	ErrProtocol = errors.New("mqtt: protocol violation")
+	// ErrInHandler is returned when a message handler calls a method
+	// waiting for an acknowledgment (only QoS 0 publications are
+	// allowed from a handler)
+	ErrInHandler = errors.New("mqtt: cannot wait for an acknowledgment in a handler")
+
+	// Errors of the CONNACK return codes
+	ErrUnacceptableProtocol = errors.New("mqtt: connection refused, unacceptable protocol version")
+	ErrIdentifierRejected   = errors.New("mqtt: connection refused, identifier rejected")
+	ErrServerUnavailable    = errors.New("mqtt: connection refused, server unavailable")
+	ErrBadCredentials       = errors.New("mqtt: connection refused, bad user name or password")
+	ErrNotAuthorized        = errors.New("mqtt: connection refused, not authorized")
+)
+
+// refused maps the CONNACK return codes to the errors
+var refused = [...]error{
+	nil,
+	ErrUnacceptableProtocol,
+	ErrIdentifierRejected,
+	ErrServerUnavailable,
+	ErrBadCredentials,
+	ErrNotAuthorized,
+}
+
+const (
+	// DefaultPort is the MQTT port of the brokers
+	DefaultPort uint16 = 1883
+	// MaxPacketSize is the size of the send and receive buffers. The
+	// incoming packets which do not fit are dropped.
+	MaxPacketSize = 256
+	// MaxSubscriptions is the number of filters the client can
+	// subscribe to
+	MaxSubscriptions = 4
+)
+
+// Will is the message published by the broker when the client
+// disappears without disconnecting
+type Will struct {
+	Topic   string
+	Message []uint8
+	QoS     uint8
+	Retain  bool
+}
+
+// Options are the connection settings
+type Options struct {
+	// ClientID identifies the client (the broker may assign one
+	// when it is empty and CleanSession is set)
+	ClientID string
+	// Username and Password are sent if not empty
+	Username string
+	Password string
+	// Will is the last will (optional)
+	Will *Will
+	// KeepAlive is the maximum time between two packets sent by
+	// the client (0 disables the keep-alive)
+	KeepAlive time.Duration
+	// CleanSession discards the session kept by the broker
+	CleanSession bool
+	// Timeout is the time to wait for the acknowledgments
+	Timeout time.Duration
+	// ReconnectDelay is the minimum time between two connection
+	// attempts made by Poll
+	ReconnectDelay time.Duration
+}
+
+// Message is a message received on a subscribed topic. Its fields
+// point into the receive buffer and are only valid until the handler
+// returns.
+type Message struct {
+	Topic     []uint8
+	Payload   []uint8
+	QoS       uint8
+	Retain    bool
+	Duplicate bool
+}
+
+// Handler is called for every message received on a subscription
+type Handler func(m *Message)
+
+// subscription is a filter and its handler
+type subscription struct {
+	filter  string
+	qos     uint8
+	handler Handler
+}
+
+// Client is an MQTT 3.1.1 client using a single TCP socket. It is
+// driven from the main loop: Poll must be called regularly to
+// receive the messages, keep the connection alive and reconnect.
+type Client struct {
+	wiznet *w5100.W5100
+	broker [4]uint8
+	port   uint16
+	opts   Options
+
+	conn        *w5100.Conn
+	connected   bool
+	tx          packet
+	rx          [MaxPacketSize]uint8
+	rxLen       int
+	skip        int      // bytes of an oversized packet left to drop
+	ack         [2]uint8 // body of the last acknowledgment
+	nextID      uint16
+	subs        [MaxSubscriptions]subscription
+	dispatching bool      // a handler is running
+	lastSent    time.Time // last packet sent (keep-alive)
+	pingSent    time.Time // pending PINGREQ (zero if none)
+	lastAttempt time.Time // last connection attempt
+}
+
+// NewClient returns a client for the broker at the given address
+func NewClient(w *w5100.W5100, broker []uint8, port uint16, opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = 5 * time.Second
+	}
+	c := &Client{wiznet: w, port: port, opts: opts}
+	copy(c.broker[:], broker)
+	return c
+}
+
+// Connected tells whether the client is connected to the broker
+// (the socket is still ESTABLISHED)
+func (c *Client) Connected() bool {
+	return c.connected && c.conn.Socket().Status() == w5100.Status.ESTABLISHED
+}
+
+// Connect opens the connection to the broker, sends the CONNECT
+// packet and subscribes again to the filters if the broker has no
+// session for the client
+func (c *Client) Connect(ctx context.Context) error {
+	if c.dispatching {
+		return ErrInHandler
+	}
+	c.drop()
+	c.lastAttempt = time.Now()
+
+	sock, err := c.wiznet.Open(w5100.Mode.TCP, 0, 0)
+	if err != nil {
+		return err
+	}
+	if err := sock.ConnectContext(ctx, c.broker[:], c.port); err != nil {
+		sock.Close()
+		return err
+	}
+	c.conn = w5100.NewConn(sock)
+	c.rxLen, c.skip = 0, 0
+
+	if err := c.sendConnect(); err != nil {
+		c.drop()
+		return err
+	}
+	if err := c.await(ctx, typeConnack, 0); err != nil {
+		c.drop()
+		return err
+	}
+	if rc := c.ack[1]; rc != 0 {
+		c.drop()
+		if int(rc) < len(refused) {
+			return refused[rc]
+		}
+		return ErrProtocol
+	}
+	c.connected = true
+	c.pingSent = time.Time{}
+
+	if sessionPresent := c.ack[0]&0x01 != 0; !sessionPresent {
+		for i := range c.subs {
+			s := &c.subs[i]
+			if s.filter == "" {
+				continue
+			}
+			if err := c.subscribe(ctx, s.filter, s.qos); err != nil {
+				c.drop()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sendConnect sends the CONNECT packet
+func (c *Client) sendConnect() error {
+	o := &c.opts
+	flags := uint8(0)
+	if o.CleanSession {
+		flags |= flagCleanSession
+	}
+	if o.Will != nil {
+		if !validTopic(o.Will.Topic) {
+			return ErrInvalidTopic
+		}
+		if o.Will.QoS > 2 {
+			return ErrInvalidQoS
+		}
+		flags |= flagWill | o.Will.QoS<<3
+		if o.Will.Retain {
+			flags |= flagWillRetain
+		}
+	}
+	if o.Username != "" {
+		flags |= flagUsername
+	}
+	if o.Password != "" {
+		flags |= flagPassword
+	}
+
+	p := &c.tx
+	p.start()
+	p.string("MQTT")
+	p.byte1(protocolLevel)
+	p.byte1(flags)
+	p.uint16(uint16(o.KeepAlive / time.Second))
+	p.string(o.ClientID)
+	if o.Will != nil {
+		p.string(o.Will.Topic)
+		p.uint16(uint16(len(o.Will.Message)))
+		p.bytes(o.Will.Message)
+	}
+	if o.Username != "" {
+		p.string(o.Username)
+	}
+	if o.Password != "" {
+		p.string(o.Password)
+	}
+	return c.send(typeConnect << 4)
+}
+
+// Disconnect sends the DISCONNECT packet and closes the connection
+// (the will is not published)
+func (c *Client) Disconnect() error {
+	if !c.Connected() {
+		c.drop()
+		return ErrNotConnected
+	}
+	c.tx.start()
+	err := c.send(typeDisconnect << 4)
+	c.drop()
+	return err
+}
+
+// drop closes the connection
+func (c *Client) drop() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.connected = false
+}
+
+// deadline returns the deadline of an operation
+func (c *Client) deadline() time.Time {
+	return time.Now().Add(c.opts.Timeout)
+}
+
+// send ends the packet being built and sends it
+func (c *Client) send(header uint8) error {
+	data, ok := c.tx.end(header)
+	if !ok {
+		return ErrPacketTooLarge
+	}
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	c.conn.SetWriteDeadline(c.deadline())
+	if _, err := c.conn.Write(data); err != nil {
+		c.drop()
+		return err
+	}
+	c.lastSent = time.Now()
+	return nil
+}
+
+// id returns a new packet identifier
+func (c *Client) id() uint16 {
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	return c.nextID
+}
+
+// Publish sends a message with the QoS 0 (at most once) or 1 (at
+// least once, it returns once the broker has acknowledged it)
+func (c *Client) Publish(ctx context.Context, topic string, payload []uint8, qos uint8, retain bool) error {
+	if !validTopic(topic) {
+		return ErrInvalidTopic
+	}
+	if qos > 1 {
+		return ErrInvalidQoS
+	}
+	if qos > 0 && c.dispatching {
+		return ErrInHandler
+	}
+	if !c.Connected() {
+		return ErrNotConnected
+	}
+
+	header := typePublish<<4 | qos<<1
+	if retain {
+		header |= 0x01
+	}
+	p := &c.tx
+	p.start()
+	p.string(topic)
+	var id uint16
+	if qos > 0 {
+		id = c.id()
+		p.uint16(id)
+	}
+	p.bytes(payload)
+	if err := c.send(header); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+	return c.await(ctx, typePuback, id)
+}
+
+// Subscribe subscribes to the filter with the maximum QoS (0 or 1).
+// The handler is called by Poll for every message matching the
+// filter. Subscribing again to a filter replaces its handler.
+func (c *Client) Subscribe(ctx context.Context, filter string, qos uint8, handler Handler) error {
+	if !validFilter(filter) {
+		return ErrInvalidTopic
+	}
+	if qos > 1 {
+		return ErrInvalidQoS
+	}
+	if c.dispatching {
+		return ErrInHandler
+	}
+	free := -1
+	for i := range c.subs {
+		if c.subs[i].filter == filter {
+			free = i
+			break
+		}
+		if free < 0 && c.subs[i].filter == "" {
+			free = i
+		}
+	}
+	if free < 0 {
+		return ErrTooManySubscriptions
+	}
+	if !c.Connected() {
+		return ErrNotConnected
+	}
+	if err := c.subscribe(ctx, filter, qos); err != nil {
+		return err
+	}
+	c.subs[free] = subscription{filter: filter, qos: qos, handler: handler}
+	return nil
+}
+
+// subscribe sends the SUBSCRIBE packet and waits for its SUBACK
+func (c *Client) subscribe(ctx context.Context, filter string, qos uint8) error {
+	id := c.id()
+	p := &c.tx
+	p.start()
+	p.uint16(id)
+	p.string(filter)
+	p.byte1(qos)
+	if err := c.send(typeSubscribe<<4 | 0x02); err != nil {
+		return err
+	}
+	if err := c.await(ctx, typeSuback, id); err != nil {
+		return err
+	}
+	if c.ack[0] == 0x80 {
+		return ErrSubscribeFailed
+	}
+	return nil
+}
+
+// Unsubscribe removes the subscription to the filter
+func (c *Client) Unsubscribe(ctx context.Context, filter string) error {
+	if c.dispatching {
+		return ErrInHandler
+	}
+	for i := range c.subs {
+		if c.subs[i].filter == filter {
+			c.subs[i] = subscription{}
+		}
+	}
+	if !c.Connected() {
+		return ErrNotConnected
+	}
+	id := c.id()
+	p := &c.tx
+	p.start()
+	p.uint16(id)
+	p.string(filter)
+	if err := c.send(typeUnsubscribe<<4 | 0x02); err != nil {
+		return err
+	}
+	return c.await(ctx, typeUnsuback, id)
+}
+
+// Poll must be called from the main loop. It dispatches the
+// received messages to the handlers, sends the keep-alive pings and
+// reconnects (at most every ReconnectDelay) when the connection is
+// lost.
+func (c *Client) Poll(ctx context.Context) error {
+	if !c.Connected() {
+		if c.conn != nil || c.connected {
+			c.drop()
+		}
+		if !c.lastAttempt.IsZero() && time.Since(c.lastAttempt) < c.opts.ReconnectDelay {
+			return ErrNotConnected
+		}
+		return c.Connect(ctx)
+	}
+
+	for {
+		typ, _, err := c.next()
+		if err != nil {
+			return err
+		}
+		if typ == 0 {
+			break
+		}
+	}
+
+	ka := c.opts.KeepAlive
+	if ka <= 0 {
+		return nil
+	}
+	if !c.pingSent.IsZero() {
+		if time.Since(c.pingSent) > ka {
+			// the broker is gone
+			c.drop()
+			return w5100.ErrTimeout
+		}
+		return nil
+	}
+	if time.Since(c.lastSent) >= ka {
+		c.tx.start()
+		if err := c.send(typePingreq << 4); err != nil {
+			return err
+		}
+		c.pingSent = time.Now()
+	}
+	return nil
+}
+
+// await processes the incoming packets until the acknowledgment of
+// the given type (and packet identifier if not zero) is received
+func (c *Client) await(ctx context.Context, want uint8, id uint16) error {
+	if c.dispatching {
+		return ErrInHandler
+	}
+	deadline := c.deadline()
+	for {
+		typ, pid, err := c.next()
+		if err != nil {
+			return err
+		}
+		if typ == want && (id == 0 || pid == id) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if typ == 0 && time.Now().After(deadline) {
+			c.drop()
+			return w5100.ErrTimeout
+		}
+	}
+}
+
+// next processes the next complete packet of the receive buffer,
+// reading the socket if needed. It returns the type and the packet
+// identifier of the packet, or a zero type if none is complete.
+func (c *Client) next() (uint8, uint16, error) {
+	if typ, id, ok, err := c.process(); ok || err != nil {
+		return typ, id, err
+	}
+	if err := c.fill(); err != nil {
+		return 0, 0, err
+	}
+	typ, id, _, err := c.process()
+	return typ, id, err
+}
+
+// fill reads the available bytes without blocking (nor allocating)
+func (c *Client) fill() error {
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	n, err := c.conn.Socket().ReadInto(c.rx[c.rxLen:])
+	if err != nil {
+		c.drop()
+		return ErrNotConnected
+	}
+	if c.skip > 0 {
+		// the end of an oversized packet
+		dropped := n
+		if dropped > c.skip {
+			dropped = c.skip
+		}
+		c.skip -= dropped
+		copy(c.rx[c.rxLen:], c.rx[c.rxLen+dropped:c.rxLen+n])
+		n -= dropped
+	}
+	c.rxLen += n
+	return nil
+}
+
+// process handles the first packet of the receive buffer if it is
+// complete
+func (c *Client) process() (uint8, uint16, bool, error) {
+	size, length, ok := parseHeader(c.rx[:c.rxLen])
+	if !ok {
+		return 0, 0, false, nil
+	}
+	if length < 0 {
+		c.drop()
+		return 0, 0, false, ErrProtocol
+	}
+	total := size + length
+	if total > len(c.rx) {
+		// drop it
+		c.skip = total - c.rxLen
+		c.rxLen = 0
+		return 0, 0, false, nil
+	}
+	if c.rxLen < total {
+		return 0, 0, false, nil
+	}
+
+	header := c.rx[0]
+	typ := header >> 4
+	id, err := c.handle(header, c.rx[size:total])
+	copy(c.rx[:], c.rx[total:c.rxLen])
+	c.rxLen -= total
+	return typ, id, true, err
+}
+
+// handle processes a packet and returns its identifier
+func (c *Client) handle(header uint8, body []uint8) (uint16, error) {
+	switch header >> 4 {
+	case typePublish:
+		return 0, c.receive(header, body)
+	case typeConnack:
+		if len(body) != 2 {
+			return 0, ErrProtocol
+		}
+		copy(c.ack[:], body)
+		return 0, nil
+	case typePuback, typeUnsuback:
+		if len(body) != 2 {
+			return 0, ErrProtocol
+		}
+		return uint16At(body, 0), nil
+	case typeSuback:
+		if len(body) < 3 {
+			return 0, ErrProtocol
+		}
+		c.ack[0] = body[2]
+		return uint16At(body, 0), nil
+	case typePubrel:
+		// end of a QoS 2 delivery
+		if len(body) != 2 {
+			return 0, ErrProtocol
+		}
+		return 0, c.acknowledge(typePubcomp<<4, uint16At(body, 0))
+	case typePingresp:
+		c.pingSent = time.Time{}
+		return 0, nil
+	}
+	return 0, ErrProtocol
+}
+
+// receive dispatches a PUBLISH packet to the handlers and
+// acknowledges it
+func (c *Client) receive(header uint8, body []uint8) error {
+	m := Message{
+		QoS:       (header >> 1) & 0x03,
+		Retain:    header&0x01 != 0,
+		Duplicate: header&0x08 != 0,
+	}
+	if len(body) < 2 {
+		return ErrProtocol
+	}
+	n := int(uint16At(body, 0))
+	if len(body) < 2+n {
+		return ErrProtocol
+	}
+	m.Topic = body[2 : 2+n]
+	body = body[2+n:]
+	var id uint16
+	if m.QoS > 0 {
+		if len(body) < 2 {
+			return ErrProtocol
+		}
+		id = uint16At(body, 0)
+		body = body[2:]
+	}
+	m.Payload = body
+
+	c.dispatching = true
+	for i := range c.subs {
+		s := &c.subs[i]
+		if s.filter != "" && s.handler != nil && match(s.filter, m.Topic) {
+			s.handler(&m)
+		}
+	}
+	c.dispatching = false
+
+	switch m.QoS {
+	case 1:
+		return c.acknowledge(typePuback<<4, id)
+	case 2:
+		return c.acknowledge(typePubrec<<4, id)
+	}
+	return nil
+}
+
+// acknowledge sends an acknowledgment packet
+func (c *Client) acknowledge(header uint8, id uint16) error {
+	c.tx.start()
+	c.tx.uint16(id)
+	return c.send(header)
+}
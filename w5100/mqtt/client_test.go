@@ -0,0 +1,304 @@
+package mqtt_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+	"github.com/asiffer/arduigo/w5100/mqtt"
+)
+
+// packet is an MQTT packet received by the broker
+type packet struct {
+	header uint8
+	body   []uint8
+}
+
+// broker is a stand-in for an MQTT broker. It runs next to the
+// client, reads what the client sends through the emulated chip and
+// answers every packet which needs it.
+type broker struct {
+	chip *emulator.Chip
+	stop chan struct{}
+	done chan struct{}
+
+	mu       sync.Mutex
+	slot     int // socket of the client
+	pending  [w5100.MaxSockNum][]uint8
+	received []packet
+}
+
+func newBroker(chip *emulator.Chip) *broker {
+	b := &broker{chip: chip, stop: make(chan struct{}), done: make(chan struct{})}
+	go b.run()
+	return b
+}
+
+// close stops the broker
+func (b *broker) close() {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+		<-b.done
+	}
+}
+
+func (b *broker) run() {
+	defer close(b.done)
+	for {
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+		for id := 0; id < w5100.MaxSockNum; id++ {
+			b.pending[id] = append(b.pending[id], b.chip.SentBytes(id)...)
+			for {
+				p, ok := b.next(id)
+				if !ok {
+					break
+				}
+				b.answer(id, p)
+			}
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+// next extracts the first complete packet sent on the socket
+func (b *broker) next(id int) (packet, bool) {
+	data := b.pending[id]
+	length, multiplier := 0, 1
+	for i := 1; i < len(data) && i <= 4; i++ {
+		length += int(data[i]&0x7F) * multiplier
+		multiplier *= 128
+		if data[i]&0x80 != 0 {
+			continue
+		}
+		if len(data) < i+1+length {
+			return packet{}, false
+		}
+		p := packet{header: data[0], body: append([]uint8(nil), data[i+1:i+1+length]...)}
+		b.pending[id] = data[i+1+length:]
+		return p, true
+	}
+	return packet{}, false
+}
+
+// answer records the packet and sends the acknowledgment
+func (b *broker) answer(id int, p packet) {
+	b.mu.Lock()
+	b.received = append(b.received, p)
+	b.mu.Unlock()
+	switch p.header >> 4 {
+	case 1: // CONNECT
+		b.mu.Lock()
+		b.slot = id
+		b.mu.Unlock()
+		b.chip.Deliver(id, []uint8{0x20, 2, 0, 0})
+	case 3: // PUBLISH
+		if p.header&0x06 != 0 {
+			n := int(p.body[0])<<8 | int(p.body[1])
+			b.chip.Deliver(id, []uint8{0x40, 2, p.body[2+n], p.body[3+n]})
+		}
+	case 8: // SUBSCRIBE
+		b.chip.Deliver(id, []uint8{0x90, 3, p.body[0], p.body[1], p.body[len(p.body)-1]})
+	case 10: // UNSUBSCRIBE
+		b.chip.Deliver(id, []uint8{0xB0, 2, p.body[0], p.body[1]})
+	case 12: // PINGREQ
+		b.chip.Deliver(id, []uint8{0xD0, 0})
+	}
+}
+
+// publish sends a message to the client
+func (b *broker) publish(topic, payload string, qos uint8) {
+	body := []uint8{0, uint8(len(topic))}
+	body = append(body, topic...)
+	if qos > 0 {
+		body = append(body, 0, 42)
+	}
+	body = append(body, payload...)
+	b.mu.Lock()
+	slot := b.slot
+	b.mu.Unlock()
+	b.chip.Deliver(slot, append([]uint8{0x30 | qos<<1, uint8(len(body))}, body...))
+}
+
+// packets returns the packets of the given type received so far
+func (b *broker) packets(typ uint8) []packet {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ps []packet
+	for _, p := range b.received {
+		if p.header>>4 == typ {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// connect returns a client connected to a broker stand-in
+func connect(t *testing.T, opts mqtt.Options) (*emulator.Chip, *mqtt.Client, *broker) {
+	t.Helper()
+	chip := emulator.New()
+	b := newBroker(chip)
+	t.Cleanup(b.close)
+	c := mqtt.NewClient(w5100.New(chip), []uint8{10, 0, 0, 1}, mqtt.DefaultPort, opts)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	return chip, c, b
+}
+
+// pollUntil polls the client until the condition holds. It yields
+// between two polls so that the broker runs on a single CPU.
+func pollUntil(t *testing.T, c *mqtt.Client, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		c.Poll(context.Background())
+		runtime.Gosched()
+	}
+}
+
+func TestConnect(t *testing.T) {
+	_, c, b := connect(t, mqtt.Options{
+		ClientID:  "dev",
+		Username:  "u",
+		Password:  "p",
+		KeepAlive: 30 * time.Second,
+		Will:      &mqtt.Will{Topic: "will", Message: []uint8("bye")},
+	})
+	if !c.Connected() {
+		t.Fatal("not connected")
+	}
+	p := b.packets(1)[0].body
+	// protocol name, level 4, flags, keep-alive, client id
+	if string(p[2:6]) != "MQTT" || p[6] != 4 || p[7] != 0xC4 || p[9] != 30 || string(p[12:15]) != "dev" {
+		t.Errorf("CONNECT %x", p)
+	}
+	if err := c.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Connected() {
+		t.Error("still connected")
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	_, c, b := connect(t, mqtt.Options{ClientID: "dev"})
+	ctx := context.Background()
+
+	var got []string
+	err := c.Subscribe(ctx, "sensors/+", 1, func(m *mqtt.Message) {
+		got = append(got, string(m.Topic)+"="+string(m.Payload))
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := c.Publish(ctx, "out", []uint8("v"), 1, false); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if ps := b.packets(3); len(ps) != 1 || string(ps[0].body[7:]) != "v" {
+		t.Errorf("published %v", ps)
+	}
+
+	b.publish("sensors/t", "21", 1)
+	b.publish("other", "x", 0)
+	b.publish("sensors/h", "40", 0)
+	pollUntil(t, c, func() bool { return len(got) == 2 })
+	if got[0] != "sensors/t=21" || got[1] != "sensors/h=40" {
+		t.Errorf("received %q", got)
+	}
+	pollUntil(t, c, func() bool { return len(b.packets(4)) == 1 })
+
+	if err := c.Unsubscribe(ctx, "sensors/+"); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	b.publish("sensors/t", "22", 0)
+	pollUntil(t, c, func() bool { return b.chip.Read16(w5100.CH_BASE+w5100.SocketRegister.RxRSR) == 0 })
+	c.Poll(ctx)
+	if len(got) != 2 {
+		t.Errorf("received after Unsubscribe: %q", got)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	chip, c, b := connect(t, mqtt.Options{ClientID: "dev", ReconnectDelay: time.Millisecond})
+	ctx := context.Background()
+	var got []string
+	c.Subscribe(ctx, "a", 0, func(m *mqtt.Message) { got = append(got, string(m.Payload)) })
+
+	chip.RemoteClose(0)
+	pollUntil(t, c, func() bool { return len(b.packets(1)) == 2 && c.Connected() })
+	if len(b.packets(8)) != 2 {
+		t.Fatal("the subscription is not restored")
+	}
+	b.publish("a", "again", 0)
+	pollUntil(t, c, func() bool { return len(got) == 1 })
+}
+
+func TestKeepAlive(t *testing.T) {
+	_, c, b := connect(t, mqtt.Options{ClientID: "dev", KeepAlive: 50 * time.Millisecond})
+	pollUntil(t, c, func() bool { return len(b.packets(12)) >= 2 })
+	if !c.Connected() {
+		t.Error("disconnected while the broker answers the pings")
+	}
+}
+
+func TestPollNoAlloc(t *testing.T) {
+	_, c, b := connect(t, mqtt.Options{ClientID: "dev"})
+	b.close()
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		c.Poll(ctx)
+	})
+	if allocs != 0 || !c.Connected() {
+		t.Errorf("idle Poll: %v allocations", allocs)
+	}
+}
+
+// TestInHandler checks that a handler cannot send a packet which
+// needs an acknowledgment, and that nothing is sent when it tries
+func TestInHandler(t *testing.T) {
+	_, c, b := connect(t, mqtt.Options{ClientID: "dev"})
+	ctx := context.Background()
+	var errs []error
+	done := false
+	c.Subscribe(ctx, "in", 0, func(m *mqtt.Message) {
+		errs = append(errs,
+			c.Publish(ctx, "out", []uint8("qos1"), 1, false),
+			c.Subscribe(ctx, "other", 0, nil),
+			c.Unsubscribe(ctx, "in"),
+			c.Connect(ctx),
+			c.Publish(ctx, "out", []uint8("qos0"), 0, false),
+		)
+		done = true
+	})
+	b.publish("in", "x", 0)
+	pollUntil(t, c, func() bool { return done })
+
+	for i, want := range []error{mqtt.ErrInHandler, mqtt.ErrInHandler, mqtt.ErrInHandler, mqtt.ErrInHandler, nil} {
+		if errs[i] != want {
+			t.Errorf("call %d: got %v, want %v", i, errs[i], want)
+		}
+	}
+	pollUntil(t, c, func() bool { return len(b.packets(3)) == 1 })
+	if p := b.packets(3)[0]; string(p.body[5:]) != "qos0" {
+		t.Errorf("published %q", p.body)
+	}
+	if len(b.packets(8)) != 1 || len(b.packets(10)) != 0 || len(b.packets(1)) != 1 || !c.Connected() {
+		t.Error("a handler sent a packet waiting for an acknowledgment")
+	}
+	// the subscription is still there
+	b.publish("in", "y", 0)
+	pollUntil(t, c, func() bool { return len(errs) == 10 })
+}
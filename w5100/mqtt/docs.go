@@ -0,0 +1,22 @@
+// Package mqtt is a small MQTT 3.1.1 client for the W5100. It uses
+// a single TCP socket and fixed-size buffers (MaxPacketSize bytes
+// each way) so that it fits on an Uno.
+//
+// # Examples
+//
+// The client is driven from the main loop
+//
+//	client := mqtt.NewClient(w, []uint8{192, 168, 1, 2}, mqtt.DefaultPort, mqtt.Options{
+//		ClientID:  "sensor-1",
+//		KeepAlive: 30 * time.Second,
+//		Will:      &mqtt.Will{Topic: "sensors/1/status", Message: []uint8("offline"), Retain: true},
+//	})
+//	err := client.Connect(ctx)
+//	err = client.Subscribe(ctx, "sensors/1/led", 1, func(m *mqtt.Message) {
+//		led.Set(string(m.Payload) == "on")
+//	})
+//	for {
+//		client.Poll(ctx) // messages, keep-alive and reconnection
+//		client.Publish(ctx, "sensors/1/temperature", reading(), 0, false)
+//	}
+package mqtt
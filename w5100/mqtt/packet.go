@@ -0,0 +1,136 @@
+package mqtt
+
+// Control packet types (high nibble of the fixed header)
+const (
+	typeConnect     uint8 = 1
+	typeConnack     uint8 = 2
+	typePublish     uint8 = 3
+	typePuback      uint8 = 4
+	typePubrec      uint8 = 5
+	typePubrel      uint8 = 6
+	typePubcomp     uint8 = 7
+	typeSubscribe   uint8 = 8
+	typeSuback      uint8 = 9
+	typeUnsubscribe uint8 = 10
+	typeUnsuback    uint8 = 11
+	typePingreq     uint8 = 12
+	typePingresp    uint8 = 13
+	typeDisconnect  uint8 = 14
+)
+
+// CONNECT flags
+const (
+	flagCleanSession uint8 = 0x02
+	flagWill         uint8 = 0x04
+	flagWillRetain   uint8 = 0x20
+	flagPassword     uint8 = 0x40
+	flagUsername     uint8 = 0x80
+)
+
+// protocolLevel is the level of MQTT 3.1.1
+const protocolLevel uint8 = 4
+
+// packet builds a control packet into a fixed buffer. The fixed
+// header is written last, in front of the variable header, so the
+// first bytes of the buffer are kept for it.
+type packet struct {
+	buf [MaxPacketSize]uint8
+	n   int
+	ok  bool // the packet fits in the buffer
+}
+
+// headerRoom is the room kept for the fixed header
+const headerRoom = 5
+
+// start begins a new packet
+func (p *packet) start() {
+	p.n = headerRoom
+	p.ok = true
+}
+
+// byte1 appends a byte
+func (p *packet) byte1(b uint8) {
+	if p.n+1 > len(p.buf) {
+		p.ok = false
+		return
+	}
+	p.buf[p.n] = b
+	p.n++
+}
+
+// uint16 appends a big endian integer
+func (p *packet) uint16(v uint16) {
+	p.byte1(uint8(v >> 8))
+	p.byte1(uint8(v))
+}
+
+// bytes appends raw data
+func (p *packet) bytes(data []uint8) {
+	if p.n+len(data) > len(p.buf) {
+		p.ok = false
+		return
+	}
+	p.n += copy(p.buf[p.n:], data)
+}
+
+// string appends a length prefixed string
+func (p *packet) string(s string) {
+	p.uint16(uint16(len(s)))
+	if p.n+len(s) > len(p.buf) {
+		p.ok = false
+		return
+	}
+	p.n += copy(p.buf[p.n:], s)
+}
+
+// end writes the fixed header and returns the whole packet
+func (p *packet) end(header uint8) ([]uint8, bool) {
+	if !p.ok {
+		return nil, false
+	}
+	length := p.n - headerRoom
+	// encode the remaining length backwards in front of the data
+	var enc [4]uint8
+	size := 0
+	for {
+		b := uint8(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		enc[size] = b
+		size++
+		if length == 0 {
+			break
+		}
+	}
+	start := headerRoom - size - 1
+	p.buf[start] = header
+	copy(p.buf[start+1:], enc[:size])
+	return p.buf[start:p.n], true
+}
+
+// parseHeader decodes the fixed header at the beginning of data. It
+// returns the header size and the remaining length, or false if
+// more data is needed. The length is -1 when it is malformed.
+func parseHeader(data []uint8) (int, int, bool) {
+	length := 0
+	multiplier := 1
+	for i := 1; i < len(data); i++ {
+		if i > 4 {
+			return 0, -1, true
+		}
+		b := data[i]
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			return i + 1, length, true
+		}
+		multiplier *= 128
+	}
+	return 0, 0, false
+}
+
+// uint16At decodes a big endian integer
+func uint16At(data []uint8, i int) uint16 {
+	return uint16(data[i])<<8 | uint16(data[i+1])
+}
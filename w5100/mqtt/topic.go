@@ -0,0 +1,65 @@
+package mqtt
+
+// match tells whether the topic matches the filter, which can
+// contain the '+' (one level) and '#' (all the remaining levels)
+// wildcards
+func match(filter string, topic []uint8) bool {
+	// the topics starting with '$' are not matched by wildcards
+	if len(topic) > 0 && topic[0] == '$' && len(filter) > 0 && (filter[0] == '+' || filter[0] == '#') {
+		return false
+	}
+	f, t := 0, 0
+	for f < len(filter) {
+		switch filter[f] {
+		case '#':
+			return true
+		case '+':
+			// skip one level of the topic
+			for t < len(topic) && topic[t] != '/' {
+				t++
+			}
+			f++
+		default:
+			if t >= len(topic) || topic[t] != filter[f] {
+				// "a/#" also matches "a"
+				return t == len(topic) && filter[f:] == "/#"
+			}
+			f++
+			t++
+		}
+	}
+	return t == len(topic)
+}
+
+// validFilter checks the position of the wildcards in a filter
+func validFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+	for i := 0; i < len(filter); i++ {
+		switch filter[i] {
+		case '#':
+			if i != len(filter)-1 || (i > 0 && filter[i-1] != '/') {
+				return false
+			}
+		case '+':
+			if (i > 0 && filter[i-1] != '/') || (i < len(filter)-1 && filter[i+1] != '/') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validTopic checks that a topic name has no wildcard
+func validTopic(topic string) bool {
+	if topic == "" {
+		return false
+	}
+	for i := 0; i < len(topic); i++ {
+		if topic[i] == '+' || topic[i] == '#' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package w5100
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// NetConfig is the network configuration of the chip. It gathers
+// the SIPR/SUBR (Address), GWR (Gateway) and SHAR (MAC) registers
+// along with the DNS server, which is only used by the host.
+type NetConfig struct {
+	// Address is the IPv4 address of the chip and the length of
+	// the subnet mask, e.g. 192.168.1.10/24
+	Address netip.Prefix
+	// Gateway is the default router (optional)
+	Gateway netip.Addr
+	// MAC is the hardware address
+	MAC net.HardwareAddr
+	// DNS is the name server (optional)
+	DNS netip.Addr
+}
+
+// Mask returns the subnet mask (4 bytes) of the address
+func (c NetConfig) Mask() []uint8 {
+	mask := net.CIDRMask(c.Address.Bits(), 32)
+	if mask == nil {
+		return make([]uint8, 4)
+	}
+	return mask
+}
+
+// Validate checks that the configuration can be written into the
+// chip: IPv4 addresses, unicast MAC and gateway inside the subnet
+func (c NetConfig) Validate() error {
+	if !c.Address.IsValid() || !c.Address.Addr().Is4() {
+		return ErrInvalidAddress
+	}
+	ip := c.Address.Addr()
+	if ip.IsUnspecified() || ip.IsMulticast() || ip == netip.AddrFrom4([4]uint8{255, 255, 255, 255}) {
+		return ErrInvalidAddress
+	}
+	if c.Gateway.IsValid() {
+		if !c.Gateway.Is4() || !c.Address.Masked().Contains(c.Gateway) {
+			return ErrInvalidAddress
+		}
+	}
+	if c.DNS.IsValid() && !c.DNS.Is4() {
+		return ErrInvalidAddress
+	}
+	if len(c.MAC) != 6 || c.MAC[0]&0x01 != 0 {
+		return ErrInvalidMAC
+	}
+	return nil
+}
+
+// Apply validates the configuration and writes it into the chip
+// registers
+func (c NetConfig) Apply(w *W5100) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	ip := c.Address.Addr().As4()
+	var gw [4]uint8
+	if c.Gateway.IsValid() {
+		gw = c.Gateway.As4()
+	}
+	if err := w.SetMACAddress(c.MAC); err != nil {
+		return err
+	}
+	if err := w.SetIPAddress(ip[:]); err != nil {
+		return err
+	}
+	if err := w.SetSubnetMask(c.Mask()); err != nil {
+		return err
+	}
+	return w.SetGatewayIP(gw[:])
+}
+
+// Read loads the configuration from the chip registers. The DNS
+// server is left untouched since the chip does not store it. A null
+// gateway is read as an invalid (unset) address.
+func (c *NetConfig) Read(w *W5100) error {
+	bits, err := maskBits(w.GetSubnetMask())
+	if err != nil {
+		return err
+	}
+	ip, _ := netip.AddrFromSlice(w.GetIPAddress())
+	c.Address = netip.PrefixFrom(ip, bits)
+
+	c.Gateway = netip.Addr{}
+	if gw, _ := netip.AddrFromSlice(w.GetGatewayIP()); !gw.IsUnspecified() {
+		c.Gateway = gw
+	}
+	c.MAC = net.HardwareAddr(w.GetMACAddress())
+	return nil
+}
+
+// maskBits returns the prefix length of a 4 bytes subnet mask
+func maskBits(mask []uint8) (int, error) {
+	ones, bits := net.IPMask(mask).Size()
+	if bits != 32 {
+		return 0, ErrInvalidMask
+	}
+	return ones, nil
+}
+
+// String formats the configuration as a list of key=value fields,
+// the unset fields are omitted:
+//
+//	ip=192.168.1.10/24 gw=192.168.1.1 mac=de:ad:be:ef:fe:ed dns=192.168.1.1
+func (c NetConfig) String() string {
+	var b strings.Builder
+	field := func(key, value string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(value)
+	}
+	if c.Address.IsValid() {
+		field("ip", c.Address.String())
+	}
+	if c.Gateway.IsValid() {
+		field("gw", c.Gateway.String())
+	}
+	if len(c.MAC) > 0 {
+		field("mac", c.MAC.String())
+	}
+	if c.DNS.IsValid() {
+		field("dns", c.DNS.String())
+	}
+	return b.String()
+}
+
+// ParseNetConfig parses a configuration in the format of String.
+// The subnet mask can also be given in dotted form
+// (ip=192.168.1.10 mask=255.255.255.0) but it cannot be omitted.
+// The result is validated.
+func ParseNetConfig(s string) (NetConfig, error) {
+	var c NetConfig
+	var ip netip.Addr
+	bits := -1
+	for _, f := range strings.Fields(s) {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok {
+			return c, ErrInvalidConfig
+		}
+		var err error
+		switch strings.ToLower(key) {
+		case "ip":
+			if strings.Contains(value, "/") {
+				var p netip.Prefix
+				p, err = netip.ParsePrefix(value)
+				ip, bits = p.Addr(), p.Bits()
+			} else {
+				ip, err = netip.ParseAddr(value)
+			}
+		case "mask":
+			var m netip.Addr
+			if m, err = netip.ParseAddr(value); err == nil {
+				if !m.Is4() {
+					return c, ErrInvalidMask
+				}
+				mask := m.As4()
+				if bits, err = maskBits(mask[:]); err != nil {
+					return c, err
+				}
+			}
+		case "gw":
+			c.Gateway, err = netip.ParseAddr(value)
+		case "mac":
+			c.MAC, err = net.ParseMAC(value)
+		case "dns":
+			c.DNS, err = netip.ParseAddr(value)
+		default:
+			return c, ErrInvalidConfig
+		}
+		if err != nil {
+			return c, ErrInvalidConfig
+		}
+	}
+	if bits < 0 {
+		// without a mask every destination would be on link and the
+		// gateway never used
+		return c, ErrInvalidMask
+	}
+	c.Address = netip.PrefixFrom(ip, bits)
+	return c, c.Validate()
+}
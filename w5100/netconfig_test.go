@@ -0,0 +1,86 @@
+package w5100_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+func TestAddressSetters(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	w.SetIPAddress([]uint8{192, 168, 1, 15})
+
+	for _, tc := range []struct {
+		name string
+		set  func([]uint8) error
+		data []uint8
+		err  error
+	}{
+		{"ip short", w.SetIPAddress, []uint8{10, 0, 0}, w5100.ErrInvalidAddress},
+		{"gateway short", w.SetGatewayIP, nil, w5100.ErrInvalidAddress},
+		{"mask short", w.SetSubnetMask, []uint8{255}, w5100.ErrInvalidMask},
+		{"mask not contiguous", w.SetSubnetMask, []uint8{255, 0, 255, 0}, w5100.ErrInvalidMask},
+		{"mask with a hole", w.SetSubnetMask, []uint8{255, 255, 254, 1}, w5100.ErrInvalidMask},
+		{"mac short", w.SetMACAddress, []uint8{2, 0, 0}, w5100.ErrInvalidMAC},
+		{"mac long", w.SetMACAddress, []uint8{2, 0, 0, 0, 0, 1, 10, 0, 0, 9}, w5100.ErrInvalidMAC},
+	} {
+		if err := tc.set(tc.data); err != tc.err {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.err)
+		}
+	}
+	if ip := w.GetIPAddress(); !bytes.Equal(ip, []uint8{192, 168, 1, 15}) {
+		t.Errorf("SIPR overwritten: %v", ip)
+	}
+
+	if err := w.SetMACAddress([]uint8{2, 0, 0, 0, 0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetSubnetMask([]uint8{255, 255, 255, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if mac := w.GetMACAddress(); !bytes.Equal(mac, []uint8{2, 0, 0, 0, 0, 1}) {
+		t.Errorf("MAC %v", mac)
+	}
+	if mask := w.GetSubnetMask(); !bytes.Equal(mask, []uint8{255, 255, 255, 0}) {
+		t.Errorf("mask %v", mask)
+	}
+}
+
+func TestNetConfigApply(t *testing.T) {
+	c, err := w5100.ParseNetConfig("ip=192.168.1.10/24 gw=192.168.1.1 mac=02:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := w5100.New(emulator.New())
+	if err := c.Apply(w); err != nil {
+		t.Fatal(err)
+	}
+	var got w5100.NetConfig
+	if err := got.Read(w); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != c.String() {
+		t.Errorf("read back %q, want %q", got, c)
+	}
+}
+
+func TestParseNetConfig(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+		err     error
+	}{
+		{"ip=10.0.0.2/8 mac=02:00:00:00:00:01", "ip=10.0.0.2/8 mac=02:00:00:00:00:01", nil},
+		{"ip=10.0.0.2 mask=255.255.0.0 gw=10.0.0.1 mac=02:00:00:00:00:01", "ip=10.0.0.2/16 gw=10.0.0.1 mac=02:00:00:00:00:01", nil},
+		{"ip=10.0.0.2 gw=192.168.1.1 mac=02:00:00:00:00:01", "", w5100.ErrInvalidMask},
+		{"ip=10.0.0.2 mask=255.0.255.0 mac=02:00:00:00:00:01", "", w5100.ErrInvalidMask},
+		{"ip=10.0.0.2/8 gw=192.168.1.1 mac=02:00:00:00:00:01", "", w5100.ErrInvalidAddress},
+	} {
+		c, err := w5100.ParseNetConfig(tc.in)
+		if err != tc.err || (err == nil && c.String() != tc.out) {
+			t.Errorf("%q: got %q, %v", tc.in, c, err)
+		}
+	}
+}
@@ -42,6 +42,8 @@ const (
 	TxRxMaxBufSize uint16 = 0x2000 / 4
 )
 
+// Default layout (2KB per socket), see MemorySizes
+// and Socket.TxSize/RxSize for the actual ones
 const (
 
 	// SMask is the Tx buffer MASK
@@ -0,0 +1,17 @@
+// Package pcap writes the frames captured by a W5100 socket in
+// MACRAW mode in the libpcap format, so that they can be opened
+// with Wireshark or tcpdump
+//
+// # Examples
+//
+// The capture can be streamed to a host over a TCP connection
+// (socket 0 is used by the MACRAW socket)
+//
+//	sniffer, err := w.Open(w5100.Mode.MACRAW, 0, 0)
+//	conn, err := listener.Accept()
+//	err = pcap.NewWriter(conn).Capture(ctx, sniffer)
+//
+// and read with
+//
+//	nc device 9000 | wireshark -k -i -
+package pcap
@@ -0,0 +1,104 @@
+package pcap
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+// file header fields
+const (
+	magic        uint32 = 0xA1B2C3D4 // microsecond timestamps
+	versionMajor uint16 = 2
+	versionMinor uint16 = 4
+	// LinkTypeEthernet is the link type of the MACRAW frames
+	LinkTypeEthernet uint32 = 1
+)
+
+const (
+	fileHeaderSize   = 24
+	recordHeaderSize = 16
+)
+
+// Writer writes frames in the libpcap format. The file header is
+// written before the first frame.
+type Writer struct {
+	w io.Writer
+	// SnapLen is the maximum number of bytes stored for each frame
+	// (longer frames are truncated)
+	SnapLen uint32
+
+	started bool
+	buf     [fileHeaderSize]uint8
+}
+
+// NewWriter returns a writer emitting the capture to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, SnapLen: w5100.MaxFrameSize}
+}
+
+// writeFileHeader writes the global header of the capture
+func (pw *Writer) writeFileHeader() error {
+	b := pw.buf[:fileHeaderSize]
+	binary.LittleEndian.PutUint32(b[0:], magic)
+	binary.LittleEndian.PutUint16(b[4:], versionMajor)
+	binary.LittleEndian.PutUint16(b[6:], versionMinor)
+	binary.LittleEndian.PutUint32(b[8:], 0)  // thiszone
+	binary.LittleEndian.PutUint32(b[12:], 0) // sigfigs
+	binary.LittleEndian.PutUint32(b[16:], pw.SnapLen)
+	binary.LittleEndian.PutUint32(b[20:], LinkTypeEthernet)
+	_, err := pw.w.Write(b)
+	return err
+}
+
+// WriteFrame writes a frame captured at the given time
+func (pw *Writer) WriteFrame(ts time.Time, frame []uint8) error {
+	if !pw.started {
+		if err := pw.writeFileHeader(); err != nil {
+			return err
+		}
+		pw.started = true
+	}
+
+	captured := frame
+	if uint32(len(captured)) > pw.SnapLen {
+		captured = captured[:pw.SnapLen]
+	}
+	b := pw.buf[:recordHeaderSize]
+	binary.LittleEndian.PutUint32(b[0:], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(b[4:], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(captured)))
+	binary.LittleEndian.PutUint32(b[12:], uint32(len(frame)))
+	if _, err := pw.w.Write(b); err != nil {
+		return err
+	}
+	_, err := pw.w.Write(captured)
+	return err
+}
+
+// Capture writes the frames received by the MACRAW socket until the
+// context is done or an error occurs. The corrupted frames reported
+// by the chip are skipped.
+func (pw *Writer) Capture(ctx context.Context, sock *w5100.Socket) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		frame, err := sock.ReadFrame()
+		if err == w5100.ErrInvalidFrame {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if frame == nil {
+			continue
+		}
+		if err := pw.WriteFrame(time.Now(), frame); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package pcap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriteFrame(t *testing.T) {
+	var buf bytes.Buffer
+	pw := NewWriter(&buf)
+	pw.SnapLen = 4
+	ts := time.Unix(0x5F5E1000, 123456789)
+	if err := pw.WriteFrame(ts, []uint8{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.WriteFrame(ts.Add(time.Second), []uint8{1, 2, 3, 4, 5, 6}); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{
+		// file header
+		0xD4, 0xC3, 0xB2, 0xA1, // magic
+		2, 0, 4, 0, // version 2.4
+		0, 0, 0, 0, // thiszone
+		0, 0, 0, 0, // sigfigs
+		4, 0, 0, 0, // snaplen
+		1, 0, 0, 0, // Ethernet
+		// first record
+		0x00, 0x10, 0x5E, 0x5F, // seconds
+		0x40, 0xE2, 0x01, 0x00, // microseconds (123456)
+		3, 0, 0, 0, // incl_len
+		3, 0, 0, 0, // orig_len
+		1, 2, 3,
+		// second record truncated at SnapLen
+		0x01, 0x10, 0x5E, 0x5F,
+		0x40, 0xE2, 0x01, 0x00,
+		4, 0, 0, 0,
+		6, 0, 0, 0,
+		1, 2, 3, 4,
+	}
+	if got := buf.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("capture\n% x\nwant\n% x", got, want)
+	}
+}
+
+func TestDefaultSnapLen(t *testing.T) {
+	var buf bytes.Buffer
+	pw := NewWriter(&buf)
+	frame := make([]uint8, 1514)
+	if err := pw.WriteFrame(time.Now(), frame); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if len(b) != fileHeaderSize+recordHeaderSize+len(frame) {
+		t.Fatalf("%d bytes written", len(b))
+	}
+	if snap := uint32(b[16]) | uint32(b[17])<<8; snap != 1514 {
+		t.Errorf("snaplen %d", snap)
+	}
+}
+
+// failing fails the writes once it has accepted n bytes
+type failing struct {
+	n       int
+	written int
+}
+
+var errDisk = errors.New("disk full")
+
+func (f *failing) Write(p []uint8) (int, error) {
+	if f.written+len(p) > f.n {
+		return 0, errDisk
+	}
+	f.written += len(p)
+	return len(p), nil
+}
+
+func TestWriteError(t *testing.T) {
+	f := &failing{n: 0}
+	pw := NewWriter(f)
+	if err := pw.WriteFrame(time.Now(), []uint8{1}); err != errDisk {
+		t.Errorf("header: got %v", err)
+	}
+	// the file header is written again with the next frame
+	f.n = fileHeaderSize + recordHeaderSize
+	if err := pw.WriteFrame(time.Now(), []uint8{1}); err != errDisk || f.written != fileHeaderSize+recordHeaderSize {
+		t.Errorf("frame: got %v after %d bytes", err, f.written)
+	}
+}
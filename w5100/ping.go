@@ -0,0 +1,150 @@
+package w5100
+
+import (
+	"context"
+	"time"
+)
+
+// ICMP echo message types
+const (
+	icmpEchoReply   uint8 = 0
+	icmpEchoRequest uint8 = 8
+	// size of the echo header (type, code, checksum, id, sequence)
+	icmpHeaderSize = 8
+	// size of the data sent in every echo request
+	pingDataSize = 32
+)
+
+// PingStats summarizes the answers to the echo requests
+type PingStats struct {
+	Sent     int
+	Received int
+	MinRTT   time.Duration
+	MaxRTT   time.Duration
+	AvgRTT   time.Duration
+}
+
+// Loss returns the percentage of requests without reply
+func (s PingStats) Loss() int {
+	if s.Sent == 0 {
+		return 0
+	}
+	return 100 * (s.Sent - s.Received) / s.Sent
+}
+
+// SetPingBlock enables (true) or disables (false) the ping block
+// mode. When it is enabled the chip does not answer the echo
+// requests anymore.
+func (w *W5100) SetPingBlock(block bool) {
+	mr := w.read(MR)
+	if block {
+		mr |= 1 << PB
+	} else {
+		mr &^= 1 << PB
+	}
+	w.write(MR, mr)
+}
+
+// GetPingBlock tells whether the ping block mode is enabled
+func (w *W5100) GetPingBlock() bool {
+	return w.read(MR)&(1<<PB) != 0
+}
+
+// checksum computes the internet checksum (RFC 1071)
+func checksum(data []uint8) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// Ping sends count ICMP echo requests to ip (through an IPRAW socket)
+// and waits at most timeout for each reply. It returns the round
+// trip times and the number of replies.
+func (w *W5100) Ping(ip []uint8, count int, timeout time.Duration) (PingStats, error) {
+	var stats PingStats
+	if len(ip) < 4 {
+		return stats, ErrInvalidAddress
+	}
+
+	sock, err := w.OpenRaw(IPProto.ICMP)
+	if err != nil {
+		return stats, err
+	}
+	defer sock.Close()
+
+	var request [icmpHeaderSize + pingDataSize]uint8
+	id := uint16(time.Now().UnixNano())
+	request[0] = icmpEchoRequest
+	request[4] = uint8(id >> 8)
+	request[5] = uint8(id)
+	for i := icmpHeaderSize; i < len(request); i++ {
+		request[i] = uint8('a' + i%26)
+	}
+
+	for seq := 1; seq <= count; seq++ {
+		request[2], request[3] = 0, 0
+		request[6] = uint8(seq >> 8)
+		request[7] = uint8(seq)
+		sum := checksum(request[:])
+		request[2] = uint8(sum >> 8)
+		request[3] = uint8(sum)
+
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		stats.Sent++
+		_, err := sock.sendTo(ctx, ip, 0, request[:])
+		if err == nil {
+			err = sock.waitEchoReply(ctx, ip, id, uint16(seq))
+		}
+		cancel()
+
+		switch err {
+		case nil:
+			stats.add(time.Since(start))
+		case context.DeadlineExceeded, ErrTimeout:
+			// lost (or ARP failure)
+		default:
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// add records a round trip time
+func (s *PingStats) add(rtt time.Duration) {
+	if s.Received == 0 || rtt < s.MinRTT {
+		s.MinRTT = rtt
+	}
+	if rtt > s.MaxRTT {
+		s.MaxRTT = rtt
+	}
+	s.AvgRTT = (s.AvgRTT*time.Duration(s.Received) + rtt) / time.Duration(s.Received+1)
+	s.Received++
+}
+
+// waitEchoReply reads the IPRAW socket until the reply to the
+// given request is received
+func (sock *Socket) waitEchoReply(ctx context.Context, ip []uint8, id uint16, seq uint16) error {
+	return sock.wait(ctx, func() (bool, error) {
+		data, from, _ := sock.recvFrom(IPRAWHeaderSize)
+		if data == nil || len(data) < icmpHeaderSize {
+			return false, nil
+		}
+		if from[0] != ip[0] || from[1] != ip[1] || from[2] != ip[2] || from[3] != ip[3] {
+			return false, nil
+		}
+		if data[0] != icmpEchoReply || checksum(data) != 0 {
+			return false, nil
+		}
+		return uint16(data[4])<<8|uint16(data[5]) == id &&
+			uint16(data[6])<<8|uint16(data[7]) == seq, nil
+	})
+}
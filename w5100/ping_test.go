@@ -0,0 +1,145 @@
+package w5100_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+func TestChecksum(t *testing.T) {
+	// example of RFC 1071 section 3
+	data := []uint8{0x00, 0x01, 0xF2, 0x03, 0xF4, 0xF5, 0xF6, 0xF7}
+	if sum := w5100.Checksum(data); sum != 0x220D {
+		t.Errorf("checksum %#x", sum)
+	}
+	// an odd length is padded with a zero byte
+	if sum := w5100.Checksum(data[:7]); sum != 0x2304 {
+		t.Errorf("checksum of an odd length %#x", sum)
+	}
+	if sum := w5100.Checksum(append(data, 0x22, 0x0D)); sum != 0 {
+		t.Errorf("checksum of a valid message %#x", sum)
+	}
+	if sum := w5100.Checksum(nil); sum != 0xFFFF {
+		t.Errorf("checksum of nothing %#x", sum)
+	}
+}
+
+// echo is a stand-in for a host answering the echo requests sent
+// on the slot with the messages built by reply
+func echo(t *testing.T, chip *emulator.Chip, id int, reply func(from [4]uint8, req []uint8) [][]uint8) {
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for _, p := range chip.Sent(id) {
+				for _, msg := range reply(p.IP, p.Data) {
+					chip.DeliverDatagram(id, p.IP, 0, msg)
+				}
+			}
+			runtime.Gosched()
+		}
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+}
+
+// echoReply returns the reply to the request, altered by change
+// before its checksum is computed
+func echoReply(req []uint8, change func(msg []uint8)) []uint8 {
+	msg := append([]uint8(nil), req...)
+	msg[0], msg[2], msg[3] = 0, 0, 0
+	if change != nil {
+		change(msg)
+	}
+	sum := w5100.Checksum(msg)
+	msg[2], msg[3] = uint8(sum>>8), uint8(sum)
+	return msg
+}
+
+func TestPing(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	host := [4]uint8{10, 0, 0, 1}
+	echo(t, chip, 0, func(from [4]uint8, req []uint8) [][]uint8 {
+		if from != host || len(req) != 40 || req[0] != 8 || req[1] != 0 || w5100.Checksum(req) != 0 {
+			t.Errorf("request % x to %v", req, from)
+			return nil
+		}
+		good := echoReply(req, nil)
+		bad := echoReply(req, nil)
+		bad[len(bad)-1]++
+		switch req[7] {
+		case 1:
+			return [][]uint8{echoReply(req, func(msg []uint8) { msg[7]++ }), good}
+		case 2:
+			return nil // lost
+		case 3:
+			return [][]uint8{echoReply(req, func(msg []uint8) { msg[5]++ })} // id
+		case 4:
+			return [][]uint8{echoReply(req, func(msg []uint8) { msg[7]-- })} // sequence
+		case 5:
+			return [][]uint8{echoReply(req, func(msg []uint8) { msg[0] = 8 })} // type
+		case 6:
+			return [][]uint8{bad}
+		}
+		return [][]uint8{good}
+	})
+
+	stats, err := w.Ping(host[:], 7, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Sent != 7 || stats.Received != 2 || stats.Loss() != 71 {
+		t.Errorf("stats %+v", stats)
+	}
+	if stats.MinRTT <= 0 || stats.MinRTT > stats.AvgRTT || stats.AvgRTT > stats.MaxRTT || stats.MaxRTT > 50*time.Millisecond {
+		t.Errorf("round trip times %+v", stats)
+	}
+	if chip.Status(0) != w5100.Status.CLOSED || w.FreeSockets() != w5100.MaxSockNum {
+		t.Error("the IPRAW socket is not released")
+	}
+	if _, err := w.Ping([]uint8{10, 0, 0}, 1, time.Second); err != w5100.ErrInvalidAddress {
+		t.Errorf("invalid address: got %v", err)
+	}
+}
+
+func TestPingUnanswered(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	// the replies come from another host
+	echo(t, chip, 0, func(from [4]uint8, req []uint8) [][]uint8 {
+		from[3]++
+		chip.DeliverDatagram(0, from, 0, echoReply(req, nil))
+		return nil
+	})
+	stats, err := w.Ping([]uint8{10, 0, 0, 1}, 2, 20*time.Millisecond)
+	if err != nil || stats.Sent != 2 || stats.Received != 0 || stats.Loss() != 100 {
+		t.Errorf("stats %+v, %v", stats, err)
+	}
+}
+
+func TestPingBlock(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	if w.GetPingBlock() {
+		t.Error("ping block after reset")
+	}
+	w.SetPingBlock(true)
+	if !w.GetPingBlock() || chip.Read(w5100.MR) != 1<<w5100.PB {
+		t.Errorf("MR %#x", chip.Read(w5100.MR))
+	}
+	w.SetPingBlock(false)
+	if w.GetPingBlock() || chip.Read(w5100.MR) != 0 {
+		t.Errorf("MR %#x", chip.Read(w5100.MR))
+	}
+}
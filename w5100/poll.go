@@ -0,0 +1,191 @@
+package w5100
+
+import (
+	"context"
+	"time"
+)
+
+// Readiness flags reported by Poll
+const (
+	// PollReadable is set when data is received (RxRSR > 0)
+	PollReadable uint8 = 1 << iota
+	// PollWritable is set when the free Tx memory (TxFSR) reaches
+	// the threshold given to Poll
+	PollWritable
+	// PollConnected is set while the TCP connection is established
+	PollConnected
+	// PollClosed is set when the socket is closed or the peer has
+	// closed its side of the connection (CLOSE_WAIT)
+	PollClosed
+	// PollAccepted is set by the Scheduler on the first pass where
+	// the socket is connected (e.g. a client arrived on a
+	// listening socket)
+	PollAccepted
+)
+
+// PollState is the state of a socket read by Poll
+type PollState struct {
+	// Socket is the socket id
+	Socket uint8
+	// Status is the SnSR register
+	Status uint8
+	// Received is the size of the received data (RxRSR)
+	Received uint16
+	// Free is the size of the free Tx memory (TxFSR)
+	Free uint16
+	// Flags are the readiness flags (PollReadable...)
+	Flags uint8
+}
+
+// Has tells whether all the flags are set
+func (p PollState) Has(flags uint8) bool {
+	return p.Flags&flags == flags
+}
+
+// Poll reads the state of every socket in one pass. A socket is
+// writable when at least threshold bytes of Tx memory are free
+// (1 if threshold is 0). A socket whose buffer sizes cannot be read
+// (wedged chip) is reported without readiness flags.
+func (w *W5100) Poll(threshold uint16) [MaxSockNum]PollState {
+	if threshold == 0 {
+		threshold = 1
+	}
+	var states [MaxSockNum]PollState
+	for id := uint8(0); id < MaxSockNum; id++ {
+		// the sockets are read through the chip, whoever owns them
+		base := CH_BASE + uint16(id)*CH_SIZE
+		p := &states[id]
+		p.Socket = id
+		p.Status = w.read(base + SocketRegister.SR)
+		if p.Status == Status.CLOSED {
+			p.Flags = PollClosed
+			continue
+		}
+		var rxErr, txErr error
+		p.Received, rxErr = w.readStable(base + SocketRegister.RxRSR)
+		p.Free, txErr = w.readStable(base + SocketRegister.TxFSR)
+		if rxErr != nil || txErr != nil {
+			// the chip does not answer, report no readiness
+			continue
+		}
+		if p.Received > 0 {
+			p.Flags |= PollReadable
+		}
+		switch p.Status {
+		case Status.ESTABLISHED:
+			p.Flags |= PollConnected
+			if p.Free >= threshold {
+				p.Flags |= PollWritable
+			}
+		case Status.CLOSE_WAIT:
+			p.Flags |= PollClosed
+		case Status.UDP, Status.IPRAW, Status.MACRAW:
+			if p.Free >= threshold {
+				p.Flags |= PollWritable
+			}
+		}
+	}
+	return states
+}
+
+// watcher is a socket handler of the scheduler
+type watcher struct {
+	mask    uint8
+	handler func(PollState)
+}
+
+// task is a function run periodically by the scheduler
+type task struct {
+	every time.Duration
+	next  time.Time
+	fn    func()
+}
+
+// Scheduler is a cooperative scheduler run from the main loop: every
+// pass polls the sockets once, calls the handlers of the sockets
+// whose state matches their mask and runs the periodic tasks. The
+// handlers must not block (they run one after the other), e.g. an
+// HTTP handler and an MQTT client can share the loop.
+type Scheduler struct {
+	wiznet *W5100
+	// Threshold is the free Tx memory making a socket writable
+	Threshold uint16
+
+	watchers  [MaxSockNum]watcher
+	connected [MaxSockNum]bool // state of the previous pass
+	tasks     []task
+}
+
+// NewScheduler returns an empty scheduler
+func (w *W5100) NewScheduler() *Scheduler {
+	return &Scheduler{wiznet: w, Threshold: 1}
+}
+
+// Watch registers the handler of the socket. It is called on every
+// pass where one of the flags of the mask is set.
+func (s *Scheduler) Watch(id uint8, mask uint8, handler func(PollState)) error {
+	if id >= MaxSockNum {
+		return ErrInvalidSocket
+	}
+	s.watchers[id] = watcher{mask: mask, handler: handler}
+	return nil
+}
+
+// Unwatch removes the handler of the socket
+func (s *Scheduler) Unwatch(id uint8) error {
+	if id >= MaxSockNum {
+		return ErrInvalidSocket
+	}
+	s.watchers[id] = watcher{}
+	return nil
+}
+
+// Every runs the function periodically (at most once per pass).
+// A zero period runs it on every pass, e.g. to poll a protocol
+// client.
+func (s *Scheduler) Every(period time.Duration, fn func()) {
+	s.tasks = append(s.tasks, task{every: period, fn: fn})
+}
+
+// RunOnce makes a single pass and returns the number of handlers
+// and tasks called
+func (s *Scheduler) RunOnce() int {
+	count := 0
+	states := s.wiznet.Poll(s.Threshold)
+	for id := range states {
+		p := states[id]
+		connected := p.Flags&PollConnected != 0
+		if connected && !s.connected[id] {
+			p.Flags |= PollAccepted
+		}
+		s.connected[id] = connected
+
+		w := &s.watchers[id]
+		if w.handler != nil && p.Flags&w.mask != 0 {
+			w.handler(p)
+			count++
+		}
+	}
+
+	now := time.Now()
+	for i := range s.tasks {
+		t := &s.tasks[i]
+		if now.Before(t.next) {
+			continue
+		}
+		t.next = now.Add(t.every)
+		t.fn()
+		count++
+	}
+	return count
+}
+
+// Run makes passes until the context is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.RunOnce()
+	}
+}
@@ -0,0 +1,96 @@
+package w5100_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+func TestPoll(t *testing.T) {
+	chip, w, _ := connected(t, 1)
+	w.Socket(2, w5100.Mode.UDP, 53, 0)
+
+	p := w.Poll(0)
+	if !p[0].Has(w5100.PollClosed) || p[0].Flags != w5100.PollClosed {
+		t.Errorf("closed socket: %+v", p[0])
+	}
+	if p[1].Flags != w5100.PollConnected|w5100.PollWritable || p[1].Free != 2048 {
+		t.Errorf("idle connection: %+v", p[1])
+	}
+	if p[2].Flags != w5100.PollWritable {
+		t.Errorf("UDP socket: %+v", p[2])
+	}
+
+	chip.Deliver(1, []uint8("hello"))
+	p = w.Poll(4096)
+	if p[1].Flags != w5100.PollConnected|w5100.PollReadable || p[1].Received != 5 {
+		t.Errorf("data received, Tx memory under the threshold: %+v", p[1])
+	}
+
+	chip.RemoteClose(1)
+	p = w.Poll(0)
+	if p[1].Status != w5100.Status.CLOSE_WAIT || p[1].Flags != w5100.PollClosed|w5100.PollReadable {
+		t.Errorf("peer closed: %+v", p[1])
+	}
+}
+
+func TestSchedulerAccepted(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	l, err := w.Listen(80, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := w.NewScheduler()
+	var got []w5100.PollState
+	for id := uint8(0); id < w5100.MaxSockNum; id++ {
+		s.Watch(id, w5100.PollAccepted|w5100.PollReadable, func(p w5100.PollState) {
+			got = append(got, p)
+		})
+	}
+
+	if n := s.RunOnce(); n != 0 {
+		t.Fatalf("%d handlers called without client", n)
+	}
+	chip.Accept(0, peer, 51000)
+	s.RunOnce()
+	if len(got) != 1 || got[0].Socket != 0 || !got[0].Has(w5100.PollAccepted|w5100.PollConnected) {
+		t.Fatalf("accepted: %+v", got)
+	}
+	// the edge is reported once
+	s.RunOnce()
+	if len(got) != 1 {
+		t.Errorf("accepted twice: %+v", got)
+	}
+
+	chip.Deliver(0, []uint8("x"))
+	s.RunOnce()
+	if len(got) != 2 || got[1].Has(w5100.PollAccepted) || !got[1].Has(w5100.PollReadable) {
+		t.Errorf("readable: %+v", got)
+	}
+	conn, _ := l.TryAccept()
+	if conn == nil {
+		t.Fatal("no connection")
+	}
+	conn.Read(make([]uint8, 1))
+	s.RunOnce()
+	if len(got) != 2 {
+		t.Errorf("handler called without event: %+v", got)
+	}
+}
+
+func TestSchedulerTasks(t *testing.T) {
+	w := w5100.New(emulator.New())
+	s := w.NewScheduler()
+	every, hourly := 0, 0
+	s.Every(0, func() { every++ })
+	s.Every(time.Hour, func() { hourly++ })
+	for i := 0; i < 3; i++ {
+		s.RunOnce()
+	}
+	if every != 3 || hourly != 1 {
+		t.Errorf("tasks run %d and %d times", every, hourly)
+	}
+}
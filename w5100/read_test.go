@@ -0,0 +1,244 @@
+package w5100_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+func TestReadInto(t *testing.T) {
+	chip, _, sock := connected(t, 1)
+	buf := make([]uint8, 2048)
+	var got, want []uint8
+	// 5 messages of 700 bytes read 300 bytes at a time wrap around
+	// the 2KB ring
+	for i := 0; i < 5; i++ {
+		msg := bytes.Repeat([]uint8{'a' + uint8(i)}, 700)
+		want = append(want, msg...)
+		chip.Deliver(1, msg)
+		for {
+			n, err := sock.ReadInto(buf[:300])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n == 0 {
+				break
+			}
+			got = append(got, buf[:n]...)
+		}
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("received corrupted data")
+	}
+	chip.RemoteClose(1)
+	if n, err := sock.ReadInto(buf); n != 0 || err != io.EOF {
+		t.Errorf("end of stream: %d, %v", n, err)
+	}
+}
+
+func TestRecvFromInto(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	sock, _ := w.Socket(0, w5100.Mode.UDP, 5000, 0)
+	buf := make([]uint8, 10)
+	if n, _, port, err := sock.RecvFromInto(buf); n != 0 || port != 0 || err != nil {
+		t.Fatalf("without datagram: %d, %d, %v", n, port, err)
+	}
+	for i := 0; i < 200; i++ {
+		chip.DeliverDatagram(0, [4]uint8{10, 0, 0, uint8(i)}, 77, []uint8("hello"))
+		n, ip, port, err := sock.RecvFromInto(buf)
+		if err != nil || string(buf[:n]) != "hello" || ip[3] != uint8(i) || port != 77 {
+			t.Fatalf("datagram %d: %q from %v:%d, %v", i, buf[:n], ip, port, err)
+		}
+	}
+
+	chip.DeliverDatagram(0, [4]uint8{10, 0, 0, 1}, 77, []uint8("0123456789abc"))
+	chip.DeliverDatagram(0, [4]uint8{10, 0, 0, 1}, 78, []uint8("next"))
+	if n, _, _, err := sock.RecvFromInto(buf); n != 10 || err != w5100.ErrTruncated || string(buf) != "0123456789" {
+		t.Errorf("truncated datagram: %d, %v", n, err)
+	}
+	if data, _, port := sock.RecvFrom(); string(data) != "next" || port != 78 {
+		t.Errorf("datagram after a truncated one: %q from port %d", data, port)
+	}
+}
+
+func TestReadFrameInto(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	sock, _ := w.Socket(0, w5100.Mode.MACRAW, 0, 0)
+	frame := make([]uint8, 60)
+	frame[0] = 0xAA
+	buf := make([]uint8, w5100.MaxFrameSize)
+	for i := 0; i < 100; i++ {
+		chip.DeliverFrame(0, frame)
+		if n, err := sock.ReadFrameInto(buf); n != 60 || err != nil || buf[0] != 0xAA {
+			t.Fatalf("frame %d: %d, %v", i, n, err)
+		}
+	}
+	chip.DeliverFrame(0, frame)
+	if n, err := sock.ReadFrameInto(buf[:20]); n != 20 || err != w5100.ErrTruncated {
+		t.Errorf("truncated frame: %d, %v", n, err)
+	}
+	if n, err := sock.ReadFrameInto(buf); n != 0 || err != nil {
+		t.Errorf("without frame: %d, %v", n, err)
+	}
+}
+
+// commands is a bus recording the commands written in the SnCR
+// register of a socket
+type commands struct {
+	*emulator.Chip
+	id    uint8
+	frame []uint8
+	log   []uint8
+}
+
+func (b *commands) Select() {
+	b.frame = b.frame[:0]
+	b.Chip.Select()
+}
+
+func (b *commands) Transfer(data uint8) uint8 {
+	b.frame = append(b.frame, data)
+	return b.Chip.Transfer(data)
+}
+
+func (b *commands) Deselect() {
+	b.Chip.Deselect()
+	cr := w5100.CH_BASE + uint16(b.id)*w5100.CH_SIZE + w5100.SocketRegister.CR
+	if f := b.frame; len(f) == 4 && f[0] == w5100.WRITE && uint16(f[1])<<8|uint16(f[2]) == cr {
+		b.log = append(b.log, f[3])
+	}
+}
+
+func TestPeek(t *testing.T) {
+	chip := emulator.New()
+	bus := &commands{Chip: chip, id: 1}
+	w := w5100.New(bus)
+	sock, _ := w.Socket(1, w5100.Mode.TCP, 80, 0)
+	sock.Listen()
+	chip.Accept(1, peer, 51000)
+	base := w5100.CH_BASE + w5100.CH_SIZE
+	if data := sock.Peek(16); data != nil {
+		t.Errorf("Peek without data: %q", data)
+	}
+	if n, err := sock.Discard(16); n != 0 || err != nil {
+		t.Errorf("Discard without data: %d, %v", n, err)
+	}
+
+	// the next 1000 bytes wrap around the end of the 2KB ring
+	chip.Deliver(1, make([]uint8, 1500))
+	sock.Recv(1500)
+	msg := make([]uint8, 1000)
+	for i := range msg {
+		msg[i] = uint8(i * 13)
+	}
+	chip.Deliver(1, msg)
+	bus.log = nil
+	rd := chip.Read16(base + w5100.SocketRegister.RxRD)
+	buf := make([]uint8, 2048)
+	for i := 0; i < 3; i++ {
+		if got := sock.Peek(2048); !bytes.Equal(got, msg) {
+			t.Fatalf("Peek %d: %d corrupted bytes", i, len(got))
+		}
+		if n, err := sock.PeekInto(buf); n != 1000 || err != nil || !bytes.Equal(buf[:n], msg) {
+			t.Fatalf("PeekInto %d: %d, %v", i, n, err)
+		}
+	}
+	if got := sock.Peek(10); !bytes.Equal(got, msg[:10]) {
+		t.Errorf("Peek(10): % x", got)
+	}
+	if n, _ := sock.PeekInto(buf[:600]); n != 600 || !bytes.Equal(buf[:n], msg[:600]) {
+		t.Errorf("PeekInto of 600 bytes: %d", n)
+	}
+	if len(bus.log) != 0 {
+		t.Errorf("commands issued by Peek: % x", bus.log)
+	}
+	if got := chip.Read16(base + w5100.SocketRegister.RxRD); got != rd {
+		t.Errorf("RxRD moved from %d to %d", rd, got)
+	}
+	if rsr := chip.Read16(base + w5100.SocketRegister.RxRSR); rsr != 1000 {
+		t.Errorf("RSR %d", rsr)
+	}
+
+	// Discard consumes the bytes with a RECV command
+	if n, err := sock.Discard(600); n != 600 || err != nil {
+		t.Fatalf("Discard: %d, %v", n, err)
+	}
+	if string(bus.log) != string([]uint8{w5100.Command.RECV}) {
+		t.Errorf("commands issued by Discard: % x", bus.log)
+	}
+	if got := sock.Peek(5); !bytes.Equal(got, msg[600:605]) {
+		t.Errorf("Peek after Discard: % x", got)
+	}
+	if got := sock.Recv(2048); !bytes.Equal(got, msg[600:]) {
+		t.Errorf("Recv after Discard: %d bytes", len(got))
+	}
+	chip.Deliver(1, msg[:10])
+	if n, _ := sock.Discard(2048); n != 10 {
+		t.Errorf("Discard past the data: %d", n)
+	}
+	if data := sock.Peek(16); data != nil {
+		t.Errorf("Peek after discarding everything: %q", data)
+	}
+}
+
+func TestZeroAllocReads(t *testing.T) {
+	chip, w, sock := connected(t, 1)
+	data := make([]uint8, 1000)
+	buf := make([]uint8, 1024)
+	allocs := testing.AllocsPerRun(50, func() {
+		chip.Deliver(1, data)
+		sock.ReadInto(buf[:500])
+		sock.Read(buf[:1]) // the data is pending, Read does not wait
+		sock.PeekInto(buf[:10])
+		sock.Discard(10)
+		sock.ReadInto(buf)
+	})
+	if allocs != 0 {
+		t.Errorf("TCP: %v allocations", allocs)
+	}
+
+	udp, _ := w.Socket(2, w5100.Mode.UDP, 80, 0)
+	payload := []uint8("hello")
+	allocs = testing.AllocsPerRun(50, func() {
+		chip.DeliverDatagram(2, peer, 7, payload)
+		udp.RecvFromInto(buf)
+	})
+	// DeliverDatagram allocates the header on the emulator side
+	if allocs > 1 {
+		t.Errorf("UDP: %v allocations", allocs)
+	}
+}
+
+func BenchmarkRecv(b *testing.B) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	sock, _ := w.Socket(1, w5100.Mode.TCP, 80, 0)
+	sock.Listen()
+	chip.Accept(1, peer, 51000)
+	data := make([]uint8, 512)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		chip.Deliver(1, data)
+		sock.Recv(512)
+	}
+}
+
+func BenchmarkReadInto(b *testing.B) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	sock, _ := w.Socket(1, w5100.Mode.TCP, 80, 0)
+	sock.Listen()
+	chip.Accept(1, peer, 51000)
+	data := make([]uint8, 512)
+	buf := make([]uint8, 512)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		chip.Deliver(1, data)
+		sock.ReadInto(buf)
+	}
+}
@@ -18,6 +18,46 @@ const (
 	SHAR uint16 = 0x0009
 	// SIPR is the Source IP Address Register
 	SIPR uint16 = 0x000F
+	// RTR is the Retry Time-value Register (2 bytes)
+	// It sets the period of the timeout in units of 100us.
+	// A TCP segment (or ARP request) is retransmitted when
+	// no answer is received during this period.
+	RTR uint16 = 0x0017
+	// RCR is the Retry Count Register
+	// It sets the number of retransmissions. When it is
+	// exceeded, the TIMEOUT interrupt is raised.
+	RCR uint16 = 0x0019
+	// IR is the Interrupt Register
+	// The socket bits are set while the SnIR register of the
+	// socket is not null, the other bits are cleared by
+	// writing 1.
+	IR uint16 = 0x0015
+	// IMR is the Interrupt Mask Register
+	// The INT pin is asserted (low) when a bit of IR is set
+	// along with the same bit of IMR.
+	IMR uint16 = 0x0016
+	// UIPR is the Unreachable IP Address Register (4 bytes)
+	UIPR uint16 = 0x002A
+	// UPORT is the Unreachable Port Register (2 bytes)
+	UPORT uint16 = 0x002E
+)
+
+// IR/IMR: Interrupt and Interrupt Mask registers (8 bits)
+//    7		  6	  	5	  4 	3 	  2 	1 	  0
+// +-------+-------+-----+-----+-----+-----+-----+-----+
+// |CONFLIC|UNREACH|PPPoE|     | S3  | S2  | S1  | S0  |
+// +-------+-------+-----+-----+-----+-----+-----+-----+
+const (
+	// IR_CONFLICT is set when an ARP request with the IP
+	// address of the chip is received
+	IR_CONFLICT uint8 = 0x80
+	// IR_UNREACH is set when an ICMP destination unreachable
+	// message is received (see UIPR and UPORT)
+	IR_UNREACH uint8 = 0x40
+	// IR_PPPoE is set when the PPPoE connection is closed
+	IR_PPPoE uint8 = 0x20
+	// IR_SOCKETS are the socket bits (1 << socket id)
+	IR_SOCKETS uint8 = 0x0F
 )
 
 // MR: Mode register (8 bits)
@@ -0,0 +1,115 @@
+package sntp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+)
+
+var (
+	// ErrKissOfDeath is returned when the server refuses to answer
+	// (stratum 0), the client must stop querying it
+	ErrKissOfDeath = errors.New("sntp: request refused by the server (kiss-o'-death)")
+	// ErrUnsynchronized is returned when the server clock is not
+	// synchronized
+	ErrUnsynchronized = errors.New("sntp: server clock not synchronized")
+)
+
+// Client queries a NTP server
+type Client struct {
+	wiznet *w5100.W5100
+	server [4]uint8
+	// Timeout is the time to wait for each answer
+	Timeout time.Duration
+	// Retries is the number of requests sent before giving up
+	Retries int
+
+	buf [messageSize]uint8
+}
+
+// Result is the outcome of a query
+type Result struct {
+	// Time is the time of the server when the answer was received
+	Time time.Time
+	// Offset is the correction to apply to the local clock
+	// (time.Now)
+	Offset time.Duration
+	// RTT is the round trip delay (without the server processing)
+	RTT time.Duration
+	// Stratum is the stratum of the server
+	Stratum uint8
+}
+
+// NewClient returns a client querying the given server
+func NewClient(w *w5100.W5100, server []uint8) *Client {
+	c := &Client{wiznet: w, Timeout: 2 * time.Second, Retries: 3}
+	copy(c.server[:], server)
+	return c
+}
+
+// SetServer changes the NTP server
+func (c *Client) SetServer(server []uint8) {
+	copy(c.server[:], server)
+}
+
+// Query asks the time to the server and compensates the round trip
+// delay (the server is assumed to be halfway)
+func (c *Client) Query(ctx context.Context) (Result, error) {
+	sock, err := c.wiznet.Open(w5100.Mode.UDP, 0, 0)
+	if err != nil {
+		return Result{}, err
+	}
+	defer sock.Close()
+
+	for try := 0; try < c.Retries; try++ {
+		t1 := time.Now()
+		sent := toTimestamp(t1)
+		msg := buildRequest(&c.buf, sent)
+		if _, err := sock.SendToContext(ctx, c.server[:], Port, msg); err != nil {
+			return Result{}, err
+		}
+
+		deadline := t1.Add(c.Timeout)
+		for time.Now().Before(deadline) {
+			if err := ctx.Err(); err != nil {
+				return Result{}, err
+			}
+			data, ip, port := sock.RecvFrom()
+			if data == nil || port != Port || [4]uint8(ip) != c.server {
+				continue
+			}
+			t4 := time.Now()
+			r, ok, err := parseReply(data, sent)
+			if err != nil {
+				return Result{}, err
+			}
+			if !ok {
+				continue
+			}
+			return compute(t1, t4, r), nil
+		}
+	}
+	return Result{}, w5100.ErrTimeout
+}
+
+// compute applies the NTP formulas to the four timestamps
+func compute(t1, t4 time.Time, r reply) Result {
+	t2 := r.receive.Time()
+	t3 := r.transmit.Time()
+	// the local durations rely on the monotonic clock
+	elapsed := t4.Sub(t1)
+	processing := t3.Sub(t2)
+	if processing < 0 || processing > elapsed {
+		processing = 0
+	}
+	rtt := elapsed - processing
+	now := t3.Add(rtt / 2)
+	return Result{
+		Time:    now,
+		Offset:  now.Sub(t4.Round(0)),
+		RTT:     rtt,
+		Stratum: r.stratum,
+	}
+}
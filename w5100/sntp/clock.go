@@ -0,0 +1,97 @@
+package sntp
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is a software wall clock: the time of the server is kept
+// as an offset against the monotonic time of the board and it is
+// synchronized again periodically
+type Clock struct {
+	client *Client
+	// Interval is the time between two synchronizations
+	Interval time.Duration
+
+	ref     time.Time // local time of the last synchronization
+	wall    time.Time // wall time at ref
+	rtt     time.Duration
+	synced  bool
+	nextTry time.Time // next attempt after a failure
+}
+
+// NewClock returns a clock synchronized with the client (every hour
+// by default)
+func NewClock(client *Client) *Clock {
+	return &Clock{client: client, Interval: time.Hour}
+}
+
+// Sync queries the server and sets the clock
+func (k *Clock) Sync(ctx context.Context) error {
+	r, err := k.client.Query(ctx)
+	if err != nil {
+		return err
+	}
+	// from now on the clock only relies on the monotonic time
+	k.ref = time.Now()
+	k.wall = k.ref.Round(0).Add(r.Offset)
+	k.rtt = r.RTT
+	k.synced = true
+	k.nextTry = time.Time{}
+	return nil
+}
+
+// Maintain synchronizes the clock again when the interval has
+// elapsed. It must be called regularly from the main loop. After a
+// failure, the next attempt is delayed by a minute at most.
+func (k *Clock) Maintain(ctx context.Context) error {
+	if k.synced && time.Since(k.ref) < k.Interval {
+		return nil
+	}
+	if time.Now().Before(k.nextTry) {
+		return nil
+	}
+	if err := k.Sync(ctx); err != nil {
+		wait := k.Interval / 4
+		if wait > time.Minute {
+			wait = time.Minute
+		}
+		k.nextTry = time.Now().Add(wait)
+		return err
+	}
+	return nil
+}
+
+// Synced tells whether the clock has been synchronized once
+func (k *Clock) Synced() bool {
+	return k.synced
+}
+
+// Offset returns the difference between the wall time and the
+// local clock (time.Now) at the last synchronization
+func (k *Clock) Offset() time.Duration {
+	return k.wall.Sub(k.ref.Round(0))
+}
+
+// LastSync returns the time elapsed since the last synchronization
+func (k *Clock) LastSync() time.Duration {
+	if !k.synced {
+		return 0
+	}
+	return time.Since(k.ref)
+}
+
+// RTT returns the round trip delay of the last synchronization,
+// which bounds its error
+func (k *Clock) RTT() time.Duration {
+	return k.rtt
+}
+
+// Now returns the current wall time. It is the zero time until the
+// clock is synchronized.
+func (k *Clock) Now() time.Time {
+	if !k.synced {
+		return time.Time{}
+	}
+	return k.wall.Add(time.Since(k.ref))
+}
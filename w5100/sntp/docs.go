@@ -0,0 +1,15 @@
+// Package sntp gets the time from a NTP server (SNTPv4, RFC 4330)
+// with the W5100 UDP sockets and keeps a software clock on top of
+// the monotonic time of the board
+//
+// # Examples
+//
+// The clock is synchronized once and maintained from the main loop
+//
+//	clock := sntp.NewClock(sntp.NewClient(w, []uint8{162, 159, 200, 1}))
+//	err := clock.Sync(ctx)
+//	for {
+//		clock.Maintain(ctx) // resync every clock.Interval
+//		lcd.PrintTime(clock.Now())
+//	}
+package sntp
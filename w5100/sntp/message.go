@@ -0,0 +1,96 @@
+package sntp
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Port is the NTP server port
+const Port uint16 = 123
+
+const (
+	messageSize = 48
+	// version 4, client mode
+	clientHeader uint8 = 4<<3 | modeClient
+	modeClient   uint8 = 3
+	modeServer   uint8 = 4
+	modeMask     uint8 = 0x07
+	// leap indicator "clock not synchronized"
+	leapAlarm uint8 = 3
+
+	offStratum   = 1
+	offReference = 12 // kiss code when the stratum is 0
+	offOriginate = 24
+	offReceive   = 32
+	offTransmit  = 40
+)
+
+// ntpEpoch is the offset between 1900 (NTP era 0) and 1970 in seconds
+const ntpEpoch = 2208988800
+
+// timestamp is a NTP timestamp (seconds since 1900 and fraction)
+type timestamp uint64
+
+// toTimestamp converts a time to NTP
+func toTimestamp(t time.Time) timestamp {
+	sec := uint64(t.Unix()+ntpEpoch) & 0xFFFFFFFF
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return timestamp(sec<<32 | frac)
+}
+
+// Time converts a NTP timestamp. The seconds wrap in 2036 (era 1):
+// the timestamps with the most significant bit cleared are assumed
+// to be after it.
+func (ts timestamp) Time() time.Time {
+	sec := int64(ts >> 32)
+	if sec < 0x80000000 {
+		sec += 1 << 32
+	}
+	nsec := (int64(ts&0xFFFFFFFF)*1e9 + 1<<31) >> 32
+	return time.Unix(sec-ntpEpoch, nsec)
+}
+
+// buildRequest writes a client request whose transmit timestamp
+// identifies the answer
+func buildRequest(buf *[messageSize]uint8, transmit timestamp) []uint8 {
+	*buf = [messageSize]uint8{}
+	buf[0] = clientHeader
+	binary.BigEndian.PutUint64(buf[offTransmit:], uint64(transmit))
+	return buf[:]
+}
+
+// reply is the useful content of a server answer
+type reply struct {
+	stratum  uint8
+	receive  timestamp // T2
+	transmit timestamp // T3
+}
+
+// parseReply checks the answer to the request with the transmit
+// timestamp. It returns false if the message is not a valid answer.
+func parseReply(msg []uint8, sent timestamp) (reply, bool, error) {
+	var r reply
+	if len(msg) < messageSize {
+		return r, false, nil
+	}
+	if msg[0]&modeMask != modeServer {
+		return r, false, nil
+	}
+	if timestamp(binary.BigEndian.Uint64(msg[offOriginate:])) != sent {
+		return r, false, nil
+	}
+	r.stratum = msg[offStratum]
+	if r.stratum == 0 {
+		// kiss-o'-death (e.g. RATE, DENY)
+		return r, true, ErrKissOfDeath
+	}
+	if msg[0]>>6 == leapAlarm {
+		return r, true, ErrUnsynchronized
+	}
+	r.receive = timestamp(binary.BigEndian.Uint64(msg[offReceive:]))
+	r.transmit = timestamp(binary.BigEndian.Uint64(msg[offTransmit:]))
+	if r.transmit == 0 {
+		return r, false, nil
+	}
+	return r, true, nil
+}
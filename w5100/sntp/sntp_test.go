@@ -0,0 +1,240 @@
+package sntp
+
+import (
+	"context"
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+func TestTimestamp(t *testing.T) {
+	// the seconds of era 0 end on 2036-02-07 06:28:16 UTC
+	wrap := time.Date(2036, 2, 7, 6, 28, 16, 0, time.UTC)
+	for _, tc := range []struct {
+		time time.Time
+		ts   timestamp
+	}{
+		{time.Unix(0, 0), 0x83AA7E80 << 32},
+		{time.Date(2000, 1, 1, 0, 0, 0, 500_000_000, time.UTC), 0xBC17C200<<32 | 0x80000000},
+		{wrap.Add(-time.Second), 0xFFFFFFFF << 32},
+		{wrap, 0},
+		{wrap.Add(time.Second + 250*time.Millisecond), 1<<32 | 0x40000000},
+	} {
+		if ts := toTimestamp(tc.time); ts != tc.ts {
+			t.Errorf("toTimestamp(%v) = %#x, want %#x", tc.time, uint64(ts), uint64(tc.ts))
+		}
+		if got := tc.ts.Time(); !got.Equal(tc.time) {
+			t.Errorf("%#x.Time() = %v, want %v", uint64(tc.ts), got, tc.time)
+		}
+	}
+
+	// the round trip keeps the nanoseconds on both sides of the wrap
+	for _, tm := range []time.Time{
+		time.Date(1990, 6, 1, 12, 0, 0, 123456789, time.UTC),
+		time.Date(2024, 3, 10, 8, 30, 15, 999999999, time.UTC),
+		wrap.Add(-time.Nanosecond),
+		wrap.Add(time.Nanosecond),
+		time.Date(2100, 1, 1, 0, 0, 0, 1, time.UTC),
+	} {
+		if got := toTimestamp(tm).Time(); !got.Equal(tm) {
+			t.Errorf("round trip of %v: %v", tm, got)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	t1 := time.Now()
+	t4 := t1.Add(100 * time.Millisecond)
+	// the server is one second ahead
+	t2 := t1.Round(0).Add(time.Second + 40*time.Millisecond)
+	for _, tc := range []struct {
+		name       string
+		processing time.Duration
+		rtt        time.Duration
+		offset     time.Duration
+	}{
+		{"processing", 20 * time.Millisecond, 80 * time.Millisecond, time.Second},
+		{"no processing", 0, 100 * time.Millisecond, 990 * time.Millisecond},
+		{"negative processing", -20 * time.Millisecond, 100 * time.Millisecond, 970 * time.Millisecond},
+		{"processing longer than the round trip", 200 * time.Millisecond, 100 * time.Millisecond, 1190 * time.Millisecond},
+	} {
+		r := reply{stratum: 2, receive: toTimestamp(t2), transmit: toTimestamp(t2.Add(tc.processing))}
+		res := compute(t1, t4, r)
+		if res.RTT != tc.rtt || res.Offset != tc.offset || res.Stratum != 2 {
+			t.Errorf("%s: RTT %v, offset %v", tc.name, res.RTT, res.Offset)
+		}
+		if want := t4.Round(0).Add(tc.offset); !res.Time.Equal(want) {
+			t.Errorf("%s: time %v, want %v", tc.name, res.Time, want)
+		}
+	}
+}
+
+// answer builds the answer of a server to the request sent at the
+// originate timestamp
+func answer(header, stratum uint8, originate, receive, transmit timestamp) []uint8 {
+	msg := make([]uint8, messageSize)
+	msg[0] = header
+	msg[offStratum] = stratum
+	binary.BigEndian.PutUint64(msg[offOriginate:], uint64(originate))
+	binary.BigEndian.PutUint64(msg[offReceive:], uint64(receive))
+	binary.BigEndian.PutUint64(msg[offTransmit:], uint64(transmit))
+	return msg
+}
+
+func TestParseReply(t *testing.T) {
+	const sent, receive, transmit timestamp = 0xE0000000_00000001, 0xE0000001_00000000, 0xE0000001_10000000
+	server := 4<<3 | modeServer
+	r, ok, err := parseReply(answer(server, 2, sent, receive, transmit), sent)
+	if !ok || err != nil || r != (reply{stratum: 2, receive: receive, transmit: transmit}) {
+		t.Errorf("valid answer: %+v, %t, %v", r, ok, err)
+	}
+
+	kiss := answer(server, 0, sent, 0, 0)
+	copy(kiss[offReference:], "RATE")
+	for _, tc := range []struct {
+		name string
+		msg  []uint8
+		ok   bool
+		err  error
+	}{
+		{"short", answer(server, 2, sent, receive, transmit)[:messageSize-1], false, nil},
+		{"client mode", answer(4<<3|modeClient, 2, sent, receive, transmit), false, nil},
+		{"wrong originate", answer(server, 2, sent+1, receive, transmit), false, nil},
+		{"kiss-o'-death", kiss, true, ErrKissOfDeath},
+		{"leap alarm", answer(leapAlarm<<6|server, 2, sent, receive, transmit), true, ErrUnsynchronized},
+		{"leap second", answer(1<<6|server, 2, sent, receive, transmit), true, nil},
+		{"zero transmit", answer(server, 2, sent, receive, 0), false, nil},
+	} {
+		if _, ok, err := parseReply(tc.msg, sent); ok != tc.ok || err != tc.err {
+			t.Errorf("%s: %t, %v", tc.name, ok, err)
+		}
+	}
+}
+
+// server is a stand-in for a NTP server whose clock is ahead by
+// offset
+type server struct {
+	chip   *emulator.Chip
+	ip     [4]uint8
+	offset time.Duration
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu      sync.Mutex
+	down    bool
+	queries int
+}
+
+func newServer(t *testing.T, chip *emulator.Chip, offset time.Duration) *server {
+	s := &server{
+		chip:   chip,
+		ip:     [4]uint8{10, 0, 0, 123},
+		offset: offset,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	t.Cleanup(func() {
+		close(s.stop)
+		<-s.done
+	})
+	return s
+}
+
+func (s *server) run() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		for id := 0; id < w5100.MaxSockNum; id++ {
+			for _, p := range s.chip.Sent(id) {
+				if p.IP != s.ip || p.Port != Port || len(p.Data) != messageSize {
+					continue
+				}
+				s.mu.Lock()
+				s.queries++
+				down := s.down
+				s.mu.Unlock()
+				if down {
+					continue
+				}
+				now := toTimestamp(time.Now().Add(s.offset))
+				originate := timestamp(binary.BigEndian.Uint64(p.Data[offTransmit:]))
+				s.chip.DeliverDatagram(id, s.ip, Port, answer(4<<3|modeServer, 2, originate, now, now))
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// set stops or restarts the answers and returns the number of
+// queries received so far
+func (s *server) set(down bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+	return s.queries
+}
+
+func TestClockMaintain(t *testing.T) {
+	chip := emulator.New()
+	s := newServer(t, chip, time.Hour)
+	c := NewClient(w5100.New(chip), s.ip[:])
+	c.Timeout = 50 * time.Millisecond
+	c.Retries = 1
+	k := NewClock(c)
+	ctx := context.Background()
+
+	if !k.Now().IsZero() || k.Synced() {
+		t.Error("the clock is set before its synchronization")
+	}
+	if err := k.Maintain(ctx); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+	if d := k.Offset() - time.Hour; d < -100*time.Millisecond || d > 100*time.Millisecond {
+		t.Errorf("offset %v", k.Offset())
+	}
+	if d := k.Now().Sub(time.Now().Add(time.Hour)); d < -100*time.Millisecond || d > 100*time.Millisecond {
+		t.Errorf("now %v", k.Now())
+	}
+	if err := k.Maintain(ctx); err != nil || s.set(true) != 1 {
+		t.Error("synchronized again before the interval")
+	}
+
+	// the server does not answer once the interval has elapsed
+	k.ref = k.ref.Add(-k.Interval)
+	if err := k.Maintain(ctx); err != w5100.ErrTimeout {
+		t.Fatalf("Maintain without server: %v", err)
+	}
+	if wait := time.Until(k.nextTry); wait <= 59*time.Second || wait > time.Minute {
+		t.Errorf("next attempt in %v", wait)
+	}
+	if err := k.Maintain(ctx); err != nil || s.set(false) != 2 {
+		t.Error("attempted again before the delay")
+	}
+	if !k.Synced() || k.Now().IsZero() {
+		t.Error("the clock is lost after a failure")
+	}
+
+	k.nextTry = time.Now()
+	if err := k.Maintain(ctx); err != nil || k.LastSync() > time.Second || !k.nextTry.IsZero() {
+		t.Errorf("Maintain after the delay: %v", err)
+	}
+
+	// the delay is a quarter of a short interval
+	k.Interval = 20 * time.Second
+	k.ref = k.ref.Add(-k.Interval)
+	s.set(true)
+	k.Maintain(ctx)
+	if wait := time.Until(k.nextTry); wait <= 4*time.Second || wait > 5*time.Second {
+		t.Errorf("next attempt in %v", wait)
+	}
+}
@@ -1,13 +1,29 @@
 package w5100
 
-import "errors"
+import (
+	"context"
+	"io"
+	"runtime"
+	"time"
+)
+
+// maxPolls bounds the number of register reads while waiting for
+// the chip to complete a command, so that a wedged chip cannot
+// hang the board
+const maxPolls = 0xFFFF
 
 // Socket is a w5100 socket
 type Socket struct {
-	uint8         // internal socket id
-	wiznet *W5100 // pointer to the parent ethernet board
-	sBase  uint16
-	rBase  uint16
+	uint8          // internal socket id
+	wiznet  *W5100 // pointer to the parent ethernet board
+	sBase   uint16
+	rBase   uint16
+	sSize   uint16 // Tx buffer size
+	rSize   uint16 // Rx buffer size
+	sMask   uint16
+	rMask   uint16
+	timeout time.Duration // limit of the blocking operations (0 = none)
+	staged  uint16        // bytes copied in the Tx memory but not sent (see Stage)
 }
 
 // ID returns the internal socket id (from 0 to MaxSockNum)
@@ -15,24 +31,123 @@ func (sock *Socket) ID() uint8 {
 	return sock.uint8
 }
 
+// computeBases sets the location of the Tx/Rx buffers of the socket
+// according to the memory sizes of the chip (see SetMemorySizes)
 func (sock *Socket) computeBases() {
-	sock.sBase = TxBufBase + SSIZE*uint16(sock.uint8)
-	sock.rBase = RxBufBase + RSIZE*uint16(sock.uint8)
+	w := sock.wiznet
+	sock.sBase = TxBufBase
+	sock.rBase = RxBufBase
+	for i := uint8(0); i < sock.uint8; i++ {
+		sock.sBase += w.txSizes[i]
+		sock.rBase += w.rxSizes[i]
+	}
+	sock.sSize = w.txSizes[sock.uint8]
+	sock.rSize = w.rxSizes[sock.uint8]
+	sock.sMask = sock.sSize - 1
+	sock.rMask = sock.rSize - 1
+}
+
+// TxSize returns the size of the Tx buffer of the socket
+func (sock *Socket) TxSize() uint16 {
+	return sock.sSize
+}
+
+// RxSize returns the size of the Rx buffer of the socket
+func (sock *Socket) RxSize() uint16 {
+	return sock.rSize
+}
+
+// Status returns the state of the socket (SnSR register, see Status)
+func (sock *Socket) Status() uint8 {
+	return sock.read(SocketRegister.SR)
+}
+
+// SetTimeout sets the time limit of the blocking operations
+// (Connect, Send, and the Context variants). Zero means no limit
+// (only the chip TIMEOUT interrupt is considered).
+func (sock *Socket) SetTimeout(d time.Duration) {
+	sock.timeout = d
 }
 
-// exec sends a command to the socket (CR register)
-func (sock *Socket) exec(cmd uint8) {
+// Timeout returns the time limit of the blocking operations
+func (sock *Socket) Timeout() time.Duration {
+	return sock.timeout
+}
+
+// owned tells whether the handle still owns its slot. A handle is
+// stale once closed, even when the slot is open again by another
+// socket: it must not touch the slot anymore.
+func (sock *Socket) owned() bool {
+	return sock.wiznet.sockets[sock.uint8] == sock
+}
+
+// exec sends a command to the socket (CR register). It returns
+// ErrTimeout if the chip does not accept the command and ErrClosed
+// if the handle is stale.
+func (sock *Socket) exec(cmd uint8) error {
+	if !sock.owned() {
+		return ErrClosed
+	}
 	// Send command to socket
 	sock.write(SocketRegister.CR, cmd)
 	// Wait for command to complete
-	for sock.read(SocketRegister.CR) != 0 {
+	for i := 0; sock.read(SocketRegister.CR) != 0; i++ {
+		if i >= maxPolls {
+			return ErrTimeout
+		}
+	}
+	return nil
+}
+
+// wait polls the socket until done returns true or an error. It
+// stops when the context is done or the socket timeout is exceeded.
+// It yields between two polls so that the other goroutines (e.g.
+// the timers of the context) run on a cooperative scheduler, and it
+// checks the deadline of the context itself.
+func (sock *Socket) wait(ctx context.Context, done func() (bool, error)) error {
+	var deadline time.Time
+	if sock.timeout > 0 {
+		deadline = time.Now().Add(sock.timeout)
+	}
+	ctxDeadline, hasDeadline := ctx.Deadline()
+	for {
+		if ok, err := done(); ok || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		now := time.Now()
+		if hasDeadline && !now.Before(ctxDeadline) {
+			return context.DeadlineExceeded
+		}
+		if !deadline.IsZero() && now.After(deadline) {
+			return ErrTimeout
+		}
+		runtime.Gosched()
+	}
+}
+
+// Close does the job. It also releases the slot of the socket (even
+// when the chip does not accept the command). Closing a stale handle
+// returns ErrClosed and leaves the slot alone.
+func (sock *Socket) Close() error {
+	if !sock.owned() {
+		return ErrClosed
 	}
+	err := sock.reset()
+	sock.wiznet.sockets[sock.uint8] = nil
+	return err
 }
 
-// Close does the job
-func (sock *Socket) Close() {
-	sock.exec(Command.CLOSE)
+// reset closes the socket on the chip, the handle keeps the slot
+func (sock *Socket) reset() error {
+	err := sock.exec(Command.CLOSE)
 	sock.write(SocketRegister.IR, 0xFF)
+	sock.staged = 0
+	return err
 }
 
 // read returns the value stored at the given address (socket register)
@@ -72,20 +187,57 @@ func (sock *Socket) writeBuffer(addr uint16, buffer []uint8) {
 }
 
 // Listen does the job. It establisheds the connection for the channel
-// in passive (server) mode. This function waits for the request from the peer.
+// in passive (server) mode. It does not wait for the request from the peer
+// (see ListenContext).
 func (sock *Socket) Listen() error {
 	if sock.read(SocketRegister.SR) != Status.INIT {
-		return errors.New("The socket is not in INIT mode")
+		return ErrNotInit
 	}
-	sock.exec(Command.LISTEN)
-	return nil
+	return sock.exec(Command.LISTEN)
+}
+
+// ListenContext puts the socket in passive mode and waits for a peer
+// to connect, the context to be done or the socket timeout.
+func (sock *Socket) ListenContext(ctx context.Context) error {
+	if err := sock.Listen(); err != nil {
+		return err
+	}
+	return sock.wait(ctx, sock.established)
+}
+
+// established tells whether the connection is up. It fails when
+// the chip gives up (TIMEOUT interrupt) or the socket is closed.
+func (sock *Socket) established() (bool, error) {
+	switch sock.read(SocketRegister.SR) {
+	case Status.ESTABLISHED, Status.CLOSE_WAIT:
+		return true, nil
+	case Status.CLOSED:
+		if sock.read(SocketRegister.IR)&Interrupt.TIMEOUT != 0 {
+			sock.write(SocketRegister.IR, Interrupt.TIMEOUT)
+			return false, ErrTimeout
+		}
+		return false, ErrClosed
+	}
+	return false, nil
 }
 
 // Connect establishes the connection for the channel in Active (client) mode.
 // This function waits for the untill the connection is established.
 func (sock *Socket) Connect(addr []uint8, port uint16) error {
+	return sock.ConnectContext(context.Background(), addr, port)
+}
+
+// ConnectContext is like Connect but it also stops waiting when
+// the context is done
+func (sock *Socket) ConnectContext(ctx context.Context, addr []uint8, port uint16) error {
+	if !sock.owned() {
+		return ErrClosed
+	}
 	if port == 0 {
-		return errors.New("Port to connect is set to zero")
+		return ErrInvalidPort
+	}
+	if len(addr) < 4 {
+		return ErrInvalidAddress
 	}
 
 	// check address
@@ -99,7 +251,7 @@ func (sock *Socket) Connect(addr []uint8, port uint16) error {
 		}
 	}
 	if full == 4 || null == 4 {
-		return errors.New("The IP address to connect is not valid")
+		return ErrInvalidAddress
 	}
 
 	// set destination IP
@@ -107,145 +259,441 @@ func (sock *Socket) Connect(addr []uint8, port uint16) error {
 	// set destination port
 	sock.write16(SocketRegister.DPORT, port)
 	// connect
-	sock.exec(Command.CONNECT)
-
-	return nil
+	if err := sock.exec(Command.CONNECT); err != nil {
+		return err
+	}
+	return sock.wait(ctx, sock.established)
 }
 
 // Disconnect does its job
-func (sock *Socket) Disconnect() {
-	sock.exec(Command.DISCON)
+func (sock *Socket) Disconnect() error {
+	return sock.exec(Command.DISCON)
 }
 
-func (sock *Socket) getTXFreeSize() uint16 {
-	var val uint16
-	var val1 uint16 = 1
-
-	for val != val1 {
-		val1 = sock.read16(SocketRegister.TxFSR)
-		if val1 != 0 {
-			val = sock.read16(SocketRegister.TxFSR)
-		}
-	}
-	return val
+func (sock *Socket) getTXFreeSize() (uint16, error) {
+	return sock.readStable(SocketRegister.TxFSR)
 }
 
-func (sock *Socket) getRXReceivedSize() uint16 {
-	var val uint16
-	var val1 uint16 = 1
+func (sock *Socket) getRXReceivedSize() (uint16, error) {
+	return sock.readStable(SocketRegister.RxRSR)
+}
 
-	for val != val1 {
-		val1 = sock.read16(SocketRegister.RxRSR)
-		if val1 != 0 {
-			val = sock.read16(SocketRegister.RxRSR)
-		}
+// readStable reads a 16-bit socket register (see W5100.readStable).
+// It returns ErrClosed if the handle is stale.
+func (sock *Socket) readStable(addr uint16) (uint16, error) {
+	if !sock.owned() {
+		return 0, ErrClosed
 	}
-	return val
+	return sock.wiznet.readStable(CH_BASE + uint16(sock.uint8)*CH_SIZE + addr)
 }
 
 func (sock *Socket) sendDataProcessingOffset(dataOffset uint16, data []uint8) {
 	ptr := sock.read16(SocketRegister.TxWR) //readSnTX_WR(s);
 	ptr += dataOffset
-	offset := ptr & SMask
+	sock.writeData(ptr, data)
+	ptr += uint16(len(data))
+	sock.write16(SocketRegister.TxWR, ptr)
+}
+
+// writeData copies the data into the Tx memory from the pointer dst
+// (without moving TxWR)
+func (sock *Socket) writeData(dst uint16, data []uint8) {
+	offset := dst & sock.sMask
 	dstAddr := offset + sock.sBase
 	size := uint16(len(data))
 
-	if offset+size > SSIZE {
+	if offset+size > sock.sSize {
 		// Wrap around circular buffer
-		// size = SSIZE - offset
-		sock.wiznet.writeBuffer(dstAddr, data[:SSIZE-offset])
-		sock.wiznet.writeBuffer(sock.sBase, data[SSIZE-offset:])
+		// size = sSize - offset
+		sock.wiznet.writeBuffer(dstAddr, data[:sock.sSize-offset])
+		sock.wiznet.writeBuffer(sock.sBase, data[sock.sSize-offset:])
 	} else {
 		sock.wiznet.writeBuffer(dstAddr, data)
 	}
+}
 
-	ptr += size
-	sock.write16(SocketRegister.TxWR, ptr)
+// connected fails when the connection cannot carry data anymore
+func (sock *Socket) connected() error {
+	if !sock.owned() {
+		return ErrClosed
+	}
+	status := sock.read(SocketRegister.SR)
+	if (status != Status.ESTABLISHED) && (status != Status.CLOSE_WAIT) {
+		return ErrClosed
+	}
+	return nil
 }
 
-// Send sends some bytes
+// Send sends some bytes on a TCP connection (see SendTo in UDP mode).
+// It returns the number of bytes sent, less than len(buf) on failure:
+// use Write or SendContext to get the error.
 func (sock *Socket) Send(buf []uint8) uint16 {
-	var status uint8
-	var ret, freesize uint16
-	size := len(buf)
+	ret, _ := sock.SendContext(context.Background(), buf)
+	return ret
+}
 
-	if size == 0 {
-		return 0
+// SendContext is like Send but it reports why the data could not be
+// sent and stops waiting when the context is done or the socket
+// timeout is exceeded. Buffers larger than the free Tx memory are
+// sent in several chunks. Only the first 65535 bytes of a larger
+// buffer are sent and io.ErrShortWrite is returned (see Write for
+// larger buffers).
+func (sock *Socket) SendContext(ctx context.Context, buf []uint8) (uint16, error) {
+	if len(buf) > 0xFFFF {
+		n, err := sock.send(ctx, buf[:0xFFFF])
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		return uint16(n), err
 	}
+	n, err := sock.send(ctx, buf)
+	return uint16(n), err
+}
 
-	if size > int(SSIZE) {
-		ret = SSIZE // check size not to exceed MAX size.
-	} else {
-		ret = uint16(size)
+// send copies the buffer into the Tx memory as soon as some room is
+// available (as much as possible, up to the whole Tx memory) and
+// sends it chunk by chunk. The staged data is sent first. It returns
+// the number of bytes acknowledged by SEND_OK.
+func (sock *Socket) send(ctx context.Context, buf []uint8) (int, error) {
+	if err := sock.FlushContext(ctx); err != nil {
+		return 0, err
 	}
 
-	// if freebuf is available, start.
-	for freesize < ret {
-		freesize = sock.getTXFreeSize()
-		status = sock.read(SocketRegister.SR)
-		if (status != Status.ESTABLISHED) && (status != Status.CLOSE_WAIT) {
-			ret = 0
-			break
+	var n int
+	for n < len(buf) {
+		want := sock.sSize
+		if len(buf)-n < int(want) {
+			want = uint16(len(buf) - n)
+		}
+
+		// if freebuf is available, start.
+		var freesize uint16
+		err := sock.wait(ctx, func() (bool, error) {
+			var err error
+			if freesize, err = sock.getTXFreeSize(); err != nil {
+				return false, err
+			}
+			if err := sock.connected(); err != nil {
+				return false, err
+			}
+			return freesize >= want, nil
+		})
+		if err != nil {
+			return n, err
 		}
+
+		// copy data
+		chunk := buf[n:]
+		if len(chunk) > int(freesize) {
+			chunk = chunk[:freesize]
+		}
+		sock.sendDataProcessingOffset(0, chunk)
+		if err := sock.transmit(ctx); err != nil {
+			return n, err
+		}
+		n += len(chunk)
 	}
+	return n, nil
+}
 
-	// copy data
-	sock.sendDataProcessingOffset(0, buf)
-	sock.exec(Command.SEND)
+// transmit sends the data up to TxWR and waits for SEND_OK
+func (sock *Socket) transmit(ctx context.Context) error {
+	if err := sock.exec(Command.SEND); err != nil {
+		return err
+	}
 
-	for (sock.read(SocketRegister.IR) & Interrupt.SEND_OK) != Interrupt.SEND_OK {
+	err := sock.wait(ctx, func() (bool, error) {
+		ir := sock.read(SocketRegister.IR)
+		if ir&Interrupt.SEND_OK == Interrupt.SEND_OK {
+			return true, nil
+		}
+		if ir&Interrupt.TIMEOUT == Interrupt.TIMEOUT {
+			sock.write(SocketRegister.IR, Interrupt.TIMEOUT)
+			sock.reset()
+			return false, ErrTimeout
+		}
 		if sock.read(SocketRegister.SR) == Status.CLOSED {
-			sock.Close()
-			return 0
+			sock.reset()
+			return false, ErrClosed
 		}
+		return false, nil
+	})
+	if err != nil {
+		return err
 	}
 
 	sock.write(SocketRegister.IR, Interrupt.SEND_OK)
-	return ret
+	return nil
 }
 
-func (sock *Socket) recvDataProcessing(size uint16) []uint8 {
+// Stage copies the data into the Tx memory after the data already
+// staged, without sending it, so that several writes go out in a
+// single SEND (see Flush). It copies as much as the free Tx memory
+// can hold and returns ErrBufferFull when the data does not fit.
+func (sock *Socket) Stage(data []uint8) (int, error) {
+	if err := sock.connected(); err != nil {
+		return 0, err
+	}
+	size, err := sock.getTXFreeSize()
+	if err != nil {
+		return 0, err
+	}
+	var free uint16
+	if size > sock.staged {
+		free = size - sock.staged
+	}
+	n := len(data)
+	if n > int(free) {
+		n = int(free)
+	}
+	ptr := sock.read16(SocketRegister.TxWR)
+	sock.writeData(ptr+sock.staged, data[:n])
+	sock.staged += uint16(n)
+	if n < len(data) {
+		return n, ErrBufferFull
+	}
+	return n, nil
+}
+
+// Staged returns the number of bytes waiting for Flush
+func (sock *Socket) Staged() uint16 {
+	return sock.staged
+}
+
+// Flush sends the staged data in a single SEND and waits for its
+// completion
+func (sock *Socket) Flush() error {
+	return sock.FlushContext(context.Background())
+}
+
+// FlushContext is like Flush but it stops waiting when the context
+// is done or the socket timeout is exceeded
+func (sock *Socket) FlushContext(ctx context.Context) error {
+	if sock.staged == 0 {
+		return nil
+	}
+	if err := sock.connected(); err != nil {
+		sock.staged = 0
+		return err
+	}
+	sock.sendDataProcessingOffset(sock.staged, nil)
+	sock.staged = 0
+	return sock.transmit(ctx)
+}
+
+func (sock *Socket) recvDataProcessing(dst []uint8, peek bool) {
 	ptr := sock.read16(SocketRegister.RxRD)
-	data := sock.readData(ptr, size)
-	// no peek case
-	ptr += size
+	sock.readDataInto(ptr, dst)
+	if peek {
+		// the data stays in the Rx memory
+		return
+	}
+	ptr += uint16(len(dst))
 	sock.write16(SocketRegister.RxRD, ptr)
-	return data
 }
 
 func (sock *Socket) readData(src uint16, size uint16) []uint8 {
-	srcMask := src & RMask
-	srcPtr := sock.rBase + srcMask
+	data := make([]uint8, size)
+	sock.readDataInto(src, data)
+	return data
+}
+
+// readDataInto fills dst with the Rx memory starting at the pointer
+// src. When the region wraps around the end of the ring, its second
+// half is read straight after the first one in dst.
+func (sock *Socket) readDataInto(src uint16, dst []uint8) {
+	offset := src & sock.rMask
+	size := uint16(len(dst))
 
-	if (srcMask + size) > RSIZE {
-		newSize := RSIZE - srcMask
-		data0 := sock.wiznet.readBuffer(srcPtr, newSize)
-		data1 := sock.wiznet.readBuffer(sock.rBase, size-newSize)
-		return append(data0, data1...)
+	if offset+size > sock.rSize {
+		// Wrap around circular buffer
+		n := sock.rSize - offset
+		sock.wiznet.readInto(sock.rBase+offset, dst[:n])
+		sock.wiznet.readInto(sock.rBase, dst[n:])
+		return
 	}
-	return sock.wiznet.readBuffer(srcPtr, size)
+	sock.wiznet.readInto(sock.rBase+offset, dst)
+}
+
+// ended tells whether the stream is over when no data is pending:
+// the socket is closed, listening or the remote end has closed
+// its side of the connection
+func (sock *Socket) ended() (bool, error) {
+	status := sock.read(SocketRegister.SR)
+	if status == Status.LISTEN || status == Status.CLOSED || status == Status.CLOSE_WAIT {
+		// The last data may have been received along with the FIN
+		size, err := sock.getRXReceivedSize()
+		return size == 0 && err == nil, err
+	}
+	return false, nil
 }
 
 // Recv is an application I/F function which is used to receive the data in TCP mode.
 // It continues to wait for data as much as the application wants to receive.
+// It returns nil when no data is available and an empty slice at the end of
+// the stream, use Read or RecvContext to get an error instead.
 func (sock *Socket) Recv(size uint16) []uint8 {
+	data, err := sock.recv(size)
+	if err == io.EOF {
+		// The remote end has closed its side of the connection, so this is the eof state
+		return []uint8{}
+	}
+	return data
+}
+
+// recv returns the received data (at most size bytes), nil when no
+// data is available and io.EOF at the end of the stream
+func (sock *Socket) recv(size uint16) ([]uint8, error) {
 	// Check how much data is available
-	ret := sock.getRXReceivedSize()
+	ret, err := sock.getRXReceivedSize()
+	if err != nil {
+		return nil, err
+	}
 	if ret == 0 {
 		// No data available.
-		status := sock.read(SocketRegister.SR)
-		if status == Status.LISTEN || status == Status.CLOSED || status == Status.CLOSE_WAIT {
-			// The remote end has closed its side of the connection, so this is the eof state
-			return []uint8{}
+		if ended, err := sock.ended(); ended || err != nil {
+			if err == nil {
+				err = io.EOF
+			}
+			return nil, err
 		}
 		// The connection is still up, but there's no data waiting to be read
-		return nil
+		return nil, nil
 
 	} else if ret > size {
 		ret = size
 	}
 
-	data := sock.recvDataProcessing(ret)
-	sock.exec(Command.RECV)
+	data := make([]uint8, ret)
+	sock.recvDataProcessing(data, false)
+	return data, sock.exec(Command.RECV)
+}
+
+// ReadInto is like Recv but it copies the data (at most len(dst)
+// bytes) into the caller buffer instead of allocating one. It does
+// not wait: it returns 0 when no data is available and io.EOF at the
+// end of the stream.
+func (sock *Socket) ReadInto(dst []uint8) (int, error) {
+	if len(dst) == 0 {
+		return 0, nil
+	}
+	ret, err := sock.getRXReceivedSize()
+	if err != nil {
+		return 0, err
+	}
+	if ret == 0 {
+		if ended, err := sock.ended(); ended || err != nil {
+			if err == nil {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		return 0, nil
+	}
+	if int(ret) > len(dst) {
+		ret = uint16(len(dst))
+	}
+
+	sock.recvDataProcessing(dst[:ret], false)
+	return int(ret), sock.exec(Command.RECV)
+}
+
+// Available returns the number of received bytes that can be read
+// without waiting
+func (sock *Socket) Available() (uint16, error) {
+	return sock.getRXReceivedSize()
+}
+
+// Peek returns the first received bytes (at most n) without consuming
+// them: they are returned again by the next Peek, Recv or Read. It
+// returns nil when no data is available. It cannot look further than
+// the Rx memory size (see RxSize).
+func (sock *Socket) Peek(n uint16) []uint8 {
+	ret, err := sock.getRXReceivedSize()
+	if ret == 0 || err != nil {
+		return nil
+	}
+	if ret > n {
+		ret = n
+	}
+	data := make([]uint8, ret)
+	sock.recvDataProcessing(data, true)
 	return data
 }
+
+// PeekInto is like Peek but it copies the data (at most len(dst)
+// bytes) into the caller buffer and returns its length
+func (sock *Socket) PeekInto(dst []uint8) (int, error) {
+	ret, err := sock.getRXReceivedSize()
+	if err != nil {
+		return 0, err
+	}
+	if int(ret) > len(dst) {
+		ret = uint16(len(dst))
+	}
+	if ret == 0 {
+		return 0, nil
+	}
+	sock.recvDataProcessing(dst[:ret], true)
+	return int(ret), nil
+}
+
+// Discard consumes the first received bytes (at most n) without
+// reading them, e.g. once a parser has found what it was looking
+// for with Peek. It returns the number of bytes discarded.
+func (sock *Socket) Discard(n uint16) (uint16, error) {
+	ret, err := sock.getRXReceivedSize()
+	if err != nil {
+		return 0, err
+	}
+	if ret > n {
+		ret = n
+	}
+	if ret == 0 {
+		return 0, nil
+	}
+	return ret, sock.consume(sock.read16(SocketRegister.RxRD) + ret)
+}
+
+// RecvContext waits for some data (at most size bytes). It returns
+// io.EOF when the peer has closed the connection.
+func (sock *Socket) RecvContext(ctx context.Context, size uint16) ([]uint8, error) {
+	var data []uint8
+	err := sock.wait(ctx, func() (bool, error) {
+		var err error
+		data, err = sock.recv(size)
+		return data != nil, err
+	})
+	return data, err
+}
+
+// Write sends the whole buffer on a TCP connection. Buffers larger
+// than the Tx memory are sent in several chunks, copied straight
+// from p into the Tx memory (without allocation). It returns the
+// number of bytes sent and the reason of the failure if any.
+func (sock *Socket) Write(p []byte) (int, error) {
+	return sock.writeContext(context.Background(), p)
+}
+
+func (sock *Socket) writeContext(ctx context.Context, p []byte) (int, error) {
+	return sock.send(ctx, p)
+}
+
+// Read waits for some data on a TCP connection and copies it into p.
+// It returns io.EOF when the peer has closed the connection.
+func (sock *Socket) Read(p []byte) (int, error) {
+	return sock.readContext(context.Background(), p)
+}
+
+func (sock *Socket) readContext(ctx context.Context, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var n int
+	err := sock.wait(ctx, func() (bool, error) {
+		var err error
+		n, err = sock.ReadInto(p)
+		return n > 0, err
+	})
+	return n, err
+}
@@ -0,0 +1,316 @@
+package w5100_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+var peer = [4]uint8{192, 168, 1, 20}
+
+// connected returns a TCP socket on the slot with a peer connected
+func connected(t *testing.T, slot uint8) (*emulator.Chip, *w5100.W5100, *w5100.Socket) {
+	t.Helper()
+	chip := emulator.New()
+	w := w5100.New(chip)
+	sock, err := w.Socket(slot, w5100.Mode.TCP, 80, 0)
+	if err != nil {
+		t.Fatalf("Socket: %v", err)
+	}
+	if err := sock.Listen(); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	if !chip.Accept(int(slot), peer, 51000) {
+		t.Fatal("the peer cannot connect")
+	}
+	return chip, w, sock
+}
+
+func TestSocketErrors(t *testing.T) {
+	w := w5100.New(emulator.New())
+	if _, err := w.Socket(w5100.MaxSockNum, w5100.Mode.TCP, 80, 0); err != w5100.ErrInvalidSocket {
+		t.Errorf("slot %d: got %v", w5100.MaxSockNum, err)
+	}
+	if _, err := w.Socket(0, 0x0F, 80, 0); err != w5100.ErrBadProtocol {
+		t.Errorf("bad protocol: got %v", err)
+	}
+	sock, err := w.Socket(0, w5100.Mode.TCP, 80, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Socket(0, w5100.Mode.UDP, 80, 0); err != w5100.ErrSocketBusy {
+		t.Errorf("busy slot: got %v", err)
+	}
+	sock.Close()
+	if _, err := w.Socket(0, w5100.Mode.UDP, 80, 0); err != nil {
+		t.Errorf("released slot: got %v", err)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	w := w5100.New(emulator.New())
+	sock, _ := w.Socket(1, w5100.Mode.TCP, 0, 0)
+	for _, tc := range []struct {
+		addr []uint8
+		port uint16
+		err  error
+	}{
+		{[]uint8{10, 0, 0, 1}, 0, w5100.ErrInvalidPort},
+		{[]uint8{10, 0, 0}, 80, w5100.ErrInvalidAddress},
+		{[]uint8{0, 0, 0, 0}, 80, w5100.ErrInvalidAddress},
+		{[]uint8{255, 255, 255, 255}, 80, w5100.ErrInvalidAddress},
+	} {
+		if err := sock.Connect(tc.addr, tc.port); err != tc.err {
+			t.Errorf("Connect(%v, %d): got %v, want %v", tc.addr, tc.port, err, tc.err)
+		}
+	}
+	if err := sock.Connect([]uint8{10, 0, 0, 1}, 80); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if sock.Status() != w5100.Status.ESTABLISHED {
+		t.Errorf("status %#x", sock.Status())
+	}
+}
+
+func TestSendRecv(t *testing.T) {
+	chip, _, sock := connected(t, 2)
+	if data := sock.Recv(16); data != nil {
+		t.Fatalf("Recv without data: %q", data)
+	}
+	// 10 messages of 700 bytes go around the 2KB rings several times
+	var sent []uint8
+	for i := 0; i < 10; i++ {
+		msg := bytes.Repeat([]uint8{'a' + uint8(i)}, 700)
+		chip.Deliver(2, msg)
+		if got := sock.Recv(2048); !bytes.Equal(got, msg) {
+			t.Fatalf("message %d: received %d bytes", i, len(got))
+		}
+		if n := sock.Send(msg); n != 700 {
+			t.Fatalf("message %d: sent %d bytes", i, n)
+		}
+		sent = append(sent, msg...)
+	}
+	if !bytes.Equal(chip.SentBytes(2), sent) {
+		t.Error("the peer received corrupted data")
+	}
+
+	chip.Deliver(2, []uint8("last"))
+	chip.RemoteClose(2)
+	if got := sock.Recv(16); string(got) != "last" {
+		t.Errorf("data received with the FIN: %q", got)
+	}
+	if got := sock.Recv(16); got == nil || len(got) != 0 {
+		t.Errorf("end of stream: %q", got)
+	}
+}
+
+func TestSendLargerThanTxMemory(t *testing.T) {
+	chip, _, sock := connected(t, 0)
+	data := make([]uint8, 5000)
+	for i := range data {
+		data[i] = uint8(i * 7)
+	}
+	if n := sock.Send(data); n != 5000 {
+		t.Fatalf("sent %d bytes", n)
+	}
+	if !bytes.Equal(chip.SentBytes(0), data) {
+		t.Error("the peer received corrupted data")
+	}
+}
+
+func TestSendContextOverLimit(t *testing.T) {
+	chip, _, sock := connected(t, 0)
+	data := make([]uint8, 70000)
+	n, err := sock.SendContext(context.Background(), data)
+	if n != 0xFFFF || err != io.ErrShortWrite {
+		t.Fatalf("SendContext: %d, %v", n, err)
+	}
+	if len(chip.SentBytes(0)) != 0xFFFF {
+		t.Error("the peer did not receive the first 65535 bytes")
+	}
+}
+
+func TestStage(t *testing.T) {
+	chip, _, sock := connected(t, 0)
+	if err := sock.Flush(); err != nil || len(chip.Sent(0)) != 0 {
+		t.Fatalf("Flush without data: %v", err)
+	}
+	for _, part := range []string{"GET / HTTP/1.1\r\n", "Host: x\r\n", "\r\n"} {
+		if n, err := sock.Stage([]uint8(part)); n != len(part) || err != nil {
+			t.Fatalf("Stage(%q): %d, %v", part, n, err)
+		}
+	}
+	if sock.Staged() != 27 || len(chip.Sent(0)) != 0 {
+		t.Fatalf("%d bytes staged", sock.Staged())
+	}
+	if err := sock.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if p := chip.Sent(0); len(p) != 1 || string(p[0].Data) != "GET / HTTP/1.1\r\nHost: x\r\n\r\n" {
+		t.Errorf("sent %q", p)
+	}
+	if sock.Staged() != 0 {
+		t.Errorf("%d bytes staged after Flush", sock.Staged())
+	}
+
+	// the staged data wraps around the end of the 2KB ring and fills it
+	first := bytes.Repeat([]uint8{'a'}, 1500)
+	second := bytes.Repeat([]uint8{'b'}, 1000)
+	sock.Stage(first)
+	if n, err := sock.Stage(second); n != 2048-1500 || err != w5100.ErrBufferFull {
+		t.Errorf("Stage past the Tx memory: %d, %v", n, err)
+	}
+	if n, err := sock.Stage([]uint8("c")); n != 0 || err != w5100.ErrBufferFull {
+		t.Errorf("Stage in a full Tx memory: %d, %v", n, err)
+	}
+	if err := sock.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := append(first, second[:2048-1500]...)
+	if p := chip.Sent(0); len(p) != 1 || !bytes.Equal(p[0].Data, want) {
+		t.Errorf("%d packets sent", len(p))
+	}
+
+	// Send flushes the staged data first
+	sock.Stage([]uint8("head "))
+	if n := sock.Send([]uint8("body")); n != 4 {
+		t.Fatalf("sent %d bytes", n)
+	}
+	if p := chip.Sent(0); len(p) != 2 || string(p[0].Data) != "head " || string(p[1].Data) != "body" {
+		t.Errorf("sent %q", p)
+	}
+}
+
+func TestStageClosed(t *testing.T) {
+	chip, _, sock := connected(t, 0)
+	sock.Stage([]uint8("lost"))
+	chip.Timeout(0)
+	if err := sock.FlushContext(context.Background()); err != w5100.ErrClosed {
+		t.Errorf("Flush: got %v", err)
+	}
+	if sock.Staged() != 0 || len(chip.Sent(0)) != 0 {
+		t.Errorf("%d bytes staged", sock.Staged())
+	}
+	if n, err := sock.Stage([]uint8("x")); n != 0 || err != w5100.ErrClosed {
+		t.Errorf("Stage: %d, %v", n, err)
+	}
+	if err := sock.Flush(); err != nil {
+		t.Errorf("second Flush: got %v", err)
+	}
+}
+
+func TestUDP(t *testing.T) {
+	chip := emulator.New()
+	w := w5100.New(chip)
+	sock, _ := w.Socket(3, w5100.Mode.UDP, 123, 0)
+	if _, err := sock.SendTo([]uint8{1, 2, 3, 4}, 0, []uint8("x")); err != w5100.ErrInvalidPort {
+		t.Errorf("port 0: got %v", err)
+	}
+	if _, err := sock.SendTo([]uint8{1, 2, 3, 4}, 99, make([]uint8, 4096)); err != w5100.ErrBufferFull {
+		t.Errorf("large datagram: got %v", err)
+	}
+	n, err := sock.SendTo([]uint8{1, 2, 3, 4}, 99, []uint8("data"))
+	if n != 4 || err != nil {
+		t.Fatalf("SendTo: %d, %v", n, err)
+	}
+	p := chip.Sent(3)
+	if len(p) != 1 || p[0].IP != [4]uint8{1, 2, 3, 4} || p[0].Port != 99 || string(p[0].Data) != "data" {
+		t.Errorf("sent %+v", p)
+	}
+
+	for i := 0; i < 300; i++ {
+		chip.DeliverDatagram(3, [4]uint8{9, 9, 9, 9}, 5353, []uint8("hello"))
+		data, ip, port := sock.RecvFrom()
+		if string(data) != "hello" || ip[0] != 9 || port != 5353 {
+			t.Fatalf("datagram %d: %q from %v:%d", i, data, ip, port)
+		}
+	}
+	if data, _, _ := sock.RecvFrom(); data != nil {
+		t.Errorf("unexpected datagram %q", data)
+	}
+}
+
+func TestConn(t *testing.T) {
+	chip, _, sock := connected(t, 1)
+	c := w5100.NewConn(sock)
+	if got := c.RemoteAddr().String(); got != "192.168.1.20:51000" {
+		t.Errorf("RemoteAddr: %s", got)
+	}
+
+	chip.Deliver(1, []uint8("line1\nline2\n"))
+	chip.RemoteClose(1)
+	r := bufio.NewReader(c)
+	for _, want := range []string{"line1\n", "line2\n"} {
+		if line, err := r.ReadString('\n'); line != want || err != nil {
+			t.Fatalf("ReadString: %q, %v", line, err)
+		}
+	}
+	if _, err := r.ReadString('\n'); err != io.EOF {
+		t.Errorf("end of stream: got %v", err)
+	}
+
+	big := bytes.Repeat([]uint8("x"), 5000)
+	if n, err := c.Write(big); n != len(big) || err != nil {
+		t.Fatalf("Write: %d, %v", n, err)
+	}
+	if len(chip.SentBytes(1)) != len(big) {
+		t.Error("Write lost data")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err == nil {
+		t.Error("second Close succeeded")
+	}
+}
+
+// TestStaleHandle checks that a closed handle cannot touch the slot
+// once it is open again by another socket
+func TestStaleHandle(t *testing.T) {
+	chip, w, old := connected(t, 0)
+	conn := w5100.NewConn(old)
+	if err := old.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sock, err := w.Open(w5100.Mode.TCP, 80, 0)
+	if err != nil || sock.ID() != 0 {
+		t.Fatalf("Open: slot %d, %v", sock.ID(), err)
+	}
+	sock.Listen()
+	chip.Accept(0, peer, 51001)
+	chip.Deliver(0, []uint8("data"))
+
+	if err := old.Close(); err != w5100.ErrClosed {
+		t.Errorf("Close: got %v", err)
+	}
+	if err := conn.Close(); err == nil {
+		t.Error("Conn.Close succeeded")
+	}
+	if _, err := old.SendContext(context.Background(), []uint8("x")); err != w5100.ErrClosed {
+		t.Errorf("SendContext: got %v", err)
+	}
+	if _, err := old.ReadInto(make([]uint8, 16)); err != w5100.ErrClosed {
+		t.Errorf("ReadInto: got %v", err)
+	}
+	if data := old.Recv(16); data != nil {
+		t.Errorf("Recv: %q", data)
+	}
+	if err := old.Connect([]uint8{10, 0, 0, 1}, 80); err != w5100.ErrClosed {
+		t.Errorf("Connect: got %v", err)
+	}
+
+	if sock.Status() != w5100.Status.ESTABLISHED {
+		t.Fatalf("the new socket was closed: status %#x", sock.Status())
+	}
+	if got := sock.Recv(16); string(got) != "data" {
+		t.Errorf("the new socket received %q", got)
+	}
+	if len(chip.SentBytes(0)) != 0 {
+		t.Error("the stale handle sent data")
+	}
+}
@@ -1,3 +1,5 @@
+//go:build avr
+
 package w5100
 
 import (
@@ -50,11 +52,59 @@ func (spi *SPI) Init() {
 	spi.SS.High() // disable device (~RESET)
 }
 
+// Configure sets the SPI in "Begin" mode
+//
+// It starts a transaction with the parameters of
+// the W5100 ethernet board
+//
+//  SPIE (Enable Interrupt SPI bit) = 0 : Inactivation de l'interruption SPI
+// 	SPE (Enable SPI) = 1 : Active le module SPI
+// 	DORD = 0 : Envoie les données en commençant par le bit de poids fort
+// 	MSTR = 1 : Configure l'Arduino en mode MAÎTRE
+// 	CPOL = 0 : Configure l'impulsion d'horloge inactive au niveau BAS
+// 	CPHA = 0 : Valide les données sur le front sur le front montant
+// 	SPR1 = 0 et SPR0 = 0: Configure la vitesse de communication à 00 = le plus rapide (Fosc/4= 4MHz)
+//
+func (spi *SPI) Configure() {
+	// SPI Enable bit on SPCR register (SPI Control Register)
+	spi.SPCR.SetBits(avr.SPCR_SPE)
+	// Master/Slave select bit on SPCR register
+	spi.SPCR.SetBits(avr.SPCR_MSTR)
+	// SPI Mode bit on SPCR register
+	// SPI_MODE0 : CPOL -> 0, CPHA -> 0
+	spi.SPCR.ClearBits(avr.SPCR_CPOL)
+	spi.SPCR.ClearBits(avr.SPCR_CPHA)
+	// SPI data rate bit on SPCR register andSPSR register (SPI State Register)
+	// SPR1 and SPR2 (SPI Clock Rate Select) bits
+	// Les bits SPR configurent la fréquence du signal d'horloge. Quand l'esclave lit l’horloge d’une broche d’entrée, les bits SPR n’ont aucun effet sur l’esclave. La fréquence de l'horloge SPI est liée à la fréquence de l'oscillateur AVR. Plus le signal d'horloge SPI est rapide, plus le transfert de données sera rapide. vous devez respecter la fréquence d'horloge maximale spécifiée par l'esclave. le Le tableau suivant résume la relation entre la fréquence SCK et les bits SPR:
+	// SPR1 	SPR0 	SCK frequency
+	// 0 		0 		fosc/4
+	// 0 		1 		fosc/16
+	// 1 		0 		fosc/64
+	// 1 		1 		fosc/128
+	spi.SPCR.ClearBits(avr.SPCR_SPR0)
+	spi.SPCR.ClearBits(avr.SPCR_SPR1)
+	// select MOST Signifiant Bit first
+	spi.SPCR.ClearBits(avr.SPCR_DORD)
+	// SPI state (SPSR) to zero
+	spi.SPSR.Set(0)
+}
+
 // End seems to do nothing
 func (*SPI) End() {
 	// does nothing?
 }
 
+// Select pulls SS low
+func (spi *SPI) Select() {
+	spi.SS.Low()
+}
+
+// Deselect pulls SS high
+func (spi *SPI) Deselect() {
+	spi.SS.High()
+}
+
 // Transfer sends a single byte to the SPI bus
 func (spi *SPI) Transfer(data uint8) uint8 {
 	// Put data into register
@@ -0,0 +1,95 @@
+package w5100_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asiffer/arduigo/w5100"
+	"github.com/asiffer/arduigo/w5100/emulator"
+)
+
+// wedgedBus is a chip whose socket 0 misbehaves: its commands are
+// never accepted (SnCR stays set) or its RxRSR keeps changing
+type wedgedBus struct {
+	*emulator.Chip
+	frame    [4]uint8
+	n        int
+	stuckCR  bool
+	unstable bool
+	rsr      uint8
+}
+
+func (b *wedgedBus) Select() {
+	b.n = 0
+	b.Chip.Select()
+}
+
+func (b *wedgedBus) Transfer(data uint8) uint8 {
+	v := b.Chip.Transfer(data)
+	if b.n < len(b.frame) {
+		b.frame[b.n] = data
+		b.n++
+	}
+	if b.n < len(b.frame) || b.frame[0] != w5100.READ {
+		return v
+	}
+	addr := uint16(b.frame[1])<<8 | uint16(b.frame[2])
+	switch addr {
+	case w5100.CH_BASE + w5100.SocketRegister.CR:
+		if b.stuckCR {
+			return w5100.Command.RECV
+		}
+	case w5100.CH_BASE + w5100.SocketRegister.RxRSR:
+		if b.unstable {
+			b.rsr++
+			return b.rsr | 0x80
+		}
+	}
+	return v
+}
+
+func TestWedgedChip(t *testing.T) {
+	bus := &wedgedBus{Chip: emulator.New()}
+	w := w5100.New(bus)
+	sock, _ := w.Socket(0, w5100.Mode.TCP, 80, 0)
+	sock.Listen()
+	bus.Accept(0, peer, 51000)
+	bus.Deliver(0, []uint8("data"))
+
+	bus.stuckCR = true
+	buf := make([]uint8, 16)
+	if n, err := sock.ReadInto(buf); n != 4 || err != w5100.ErrTimeout {
+		t.Errorf("RECV not accepted: got %d, %v", n, err)
+	}
+	if err := sock.Disconnect(); err != w5100.ErrTimeout {
+		t.Errorf("DISCON not accepted: got %v", err)
+	}
+	bus.stuckCR = false
+
+	bus.unstable = true
+	if _, err := sock.Available(); err != w5100.ErrTimeout {
+		t.Errorf("unstable RxRSR: got %v", err)
+	}
+	if _, err := sock.Read(buf); err != w5100.ErrTimeout {
+		t.Errorf("Read with an unstable RxRSR: got %v", err)
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	_, _, sock := connected(t, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := sock.RecvContext(ctx, 16); err != context.DeadlineExceeded {
+		t.Errorf("got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("returned after %v", d)
+	}
+
+	sock.SetTimeout(20 * time.Millisecond)
+	if _, err := sock.RecvContext(context.Background(), 16); err != w5100.ErrTimeout {
+		t.Errorf("socket timeout: got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package w5100
+
+import (
+	"context"
+)
+
+// UDPHeaderSize is the size of the header the W5100 puts
+// in front of every datagram received in UDP mode:
+// peer IP (4 bytes), peer port (2 bytes), data length (2 bytes)
+const UDPHeaderSize uint16 = 8
+
+// IPRAWHeaderSize is the size of the header the W5100 puts
+// in front of every datagram received in IPRAW mode:
+// peer IP (4 bytes), data length (2 bytes)
+const IPRAWHeaderSize uint16 = 6
+
+// SendTo sends a single datagram to the given address. The socket
+// must be opened in UDP mode and the payload must fit in the
+// Tx memory. It returns the number of bytes sent.
+func (sock *Socket) SendTo(ip []uint8, port uint16, payload []uint8) (uint16, error) {
+	return sock.SendToContext(context.Background(), ip, port, payload)
+}
+
+// SendToContext is like SendTo but it stops waiting when the context
+// is done or the socket timeout is exceeded
+func (sock *Socket) SendToContext(ctx context.Context, ip []uint8, port uint16, payload []uint8) (uint16, error) {
+	if sock.read(SocketRegister.SR) != Status.UDP {
+		return 0, ErrInvalidMode
+	}
+	if len(ip) < 4 {
+		return 0, ErrInvalidAddress
+	}
+	if port == 0 {
+		return 0, ErrInvalidPort
+	}
+	return sock.sendTo(ctx, ip, port, payload)
+}
+
+// sendTo sends a datagram in UDP or IPRAW mode (where the port is
+// ignored) or a frame in MACRAW mode (where ip is nil)
+func (sock *Socket) sendTo(ctx context.Context, ip []uint8, port uint16, payload []uint8) (uint16, error) {
+	if len(payload) > int(sock.sSize) {
+		return 0, ErrBufferFull
+	}
+	size := uint16(len(payload))
+
+	// wait for enough room
+	err := sock.wait(ctx, func() (bool, error) {
+		free, err := sock.getTXFreeSize()
+		return free >= size, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// set destination of this datagram
+	if ip != nil {
+		sock.writeBuffer(SocketRegister.DIPR, ip[:4])
+		sock.write16(SocketRegister.DPORT, port)
+	}
+
+	sock.sendDataProcessingOffset(0, payload)
+	if err := sock.exec(Command.SEND); err != nil {
+		return 0, err
+	}
+
+	err = sock.wait(ctx, func() (bool, error) {
+		ir := sock.read(SocketRegister.IR)
+		if ir&Interrupt.SEND_OK != 0 {
+			sock.write(SocketRegister.IR, Interrupt.SEND_OK)
+			return true, nil
+		}
+		if ir&Interrupt.TIMEOUT != 0 {
+			// ARP failed, the destination is unreachable
+			sock.write(SocketRegister.IR, Interrupt.SEND_OK|Interrupt.TIMEOUT)
+			return false, ErrTimeout
+		}
+		return false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// RecvFrom returns a single datagram received in UDP mode along
+// with the address of its sender. The data is nil when no
+// datagram is available.
+func (sock *Socket) RecvFrom() ([]uint8, []uint8, uint16) {
+	return sock.recvFrom(UDPHeaderSize)
+}
+
+// RecvFromInto is like RecvFrom but it copies the datagram into the
+// caller buffer instead of allocating one. The port is 0 when no
+// datagram is available. When the datagram is larger than dst, it
+// is truncated and ErrTruncated is returned.
+func (sock *Socket) RecvFromInto(dst []uint8) (int, [4]uint8, uint16, error) {
+	h, ok, err := sock.datagram(UDPHeaderSize)
+	if !ok {
+		return 0, h.ip, 0, err
+	}
+	n := sock.copyData(h.ptr, h.size, dst)
+	if err := sock.consume(h.ptr + h.size); err != nil {
+		return n, h.ip, h.port, err
+	}
+	if n < int(h.size) {
+		return n, h.ip, h.port, ErrTruncated
+	}
+	return n, h.ip, h.port, nil
+}
+
+// recvFrom reads a datagram and its header (UDP or IPRAW mode)
+func (sock *Socket) recvFrom(headerSize uint16) ([]uint8, []uint8, uint16) {
+	h, ok, _ := sock.datagram(headerSize)
+	if !ok {
+		return nil, nil, 0
+	}
+	data := sock.readData(h.ptr, h.size)
+	sock.consume(h.ptr + h.size)
+	return data, h.ip[:], h.port
+}
+
+// datagramHeader is the header the chip puts in front of a datagram
+type datagramHeader struct {
+	ptr  uint16 // pointer to the data in the Rx memory
+	ip   [4]uint8
+	port uint16
+	size uint16
+}
+
+// datagram reads the header of the next datagram (UDP or IPRAW
+// mode). It returns false when no datagram is available.
+func (sock *Socket) datagram(headerSize uint16) (datagramHeader, bool, error) {
+	var h datagramHeader
+	received, err := sock.getRXReceivedSize()
+	if err != nil || received < headerSize {
+		return h, false, err
+	}
+
+	var header [UDPHeaderSize]uint8
+	ptr := sock.read16(SocketRegister.RxRD)
+	sock.readDataInto(ptr, header[:headerSize])
+	h.ptr = ptr + headerSize
+
+	copy(h.ip[:], header[:4])
+	if headerSize == UDPHeaderSize {
+		h.port = uint16(header[4])<<8 | uint16(header[5])
+	}
+	h.size = uint16(header[headerSize-2])<<8 | uint16(header[headerSize-1])
+	return h, true, nil
+}
+
+// copyData reads the received data (size bytes from the pointer
+// ptr) into dst as far as it fits and returns the bytes copied
+func (sock *Socket) copyData(ptr uint16, size uint16, dst []uint8) int {
+	n := int(size)
+	if n > len(dst) {
+		n = len(dst)
+	}
+	sock.readDataInto(ptr, dst[:n])
+	return n
+}
+
+// consume frees the Rx memory up to the pointer ptr
+func (sock *Socket) consume(ptr uint16) error {
+	sock.write16(SocketRegister.RxRD, ptr)
+	return sock.exec(Command.RECV)
+}
@@ -1,64 +1,36 @@
 package w5100
 
 import (
-	"device/avr"
-	"errors"
+	"time"
 )
 
 var localPort uint16 = 2000
 
 // W5100 basic structure to manage the ethernet card
 type W5100 struct {
-	spi     *SPI
-	sockets [MaxSockNum]Socket
+	bus     Bus
+	sockets [MaxSockNum]*Socket // handle owning every slot (nil when free)
+	txSizes MemorySizes
+	rxSizes MemorySizes
 }
 
-// Init inits the W5100 chip
-func Init() *W5100 {
-	w := &W5100{spi: DefaultSPI()}
-	w.ConfigureSPI()
-	w.write(RMSR, 0x55)
-	w.write(TMSR, 0x55)
+// New inits a W5100 chip driven through the given bus
+// (2KB of Tx/Rx memory per socket)
+func New(bus Bus) *W5100 {
+	w := &W5100{bus: bus}
 	w.write(MR, 1<<RST)
+	w.SetMemorySizes(DefaultMemorySizes, DefaultMemorySizes)
 	return w
 }
 
-// ConfigureSPI sets the SPI in "Begin" mode
-//
-// It starts a transaction with the parameters of
-// the W5100 ethernet board
-//
-//  SPIE (Enable Interrupt SPI bit) = 0 : Inactivation de l'interruption SPI
-// 	SPE (Enable SPI) = 1 : Active le module SPI
-// 	DORD = 0 : Envoie les données en commençant par le bit de poids fort
-// 	MSTR = 1 : Configure l'Arduino en mode MAÎTRE
-// 	CPOL = 0 : Configure l'impulsion d'horloge inactive au niveau BAS
-// 	CPHA = 0 : Valide les données sur le front sur le front montant
-// 	SPR1 = 0 et SPR0 = 0: Configure la vitesse de communication à 00 = le plus rapide (Fosc/4= 4MHz)
-//
-func (w *W5100) ConfigureSPI() {
-	// SPI Enable bit on SPCR register (SPI Control Register)
-	w.spi.SPCR.SetBits(avr.SPCR_SPE)
-	// Master/Slave select bit on SPCR register
-	w.spi.SPCR.SetBits(avr.SPCR_MSTR)
-	// SPI Mode bit on SPCR register
-	// SPI_MODE0 : CPOL -> 0, CPHA -> 0
-	w.spi.SPCR.ClearBits(avr.SPCR_CPOL)
-	w.spi.SPCR.ClearBits(avr.SPCR_CPHA)
-	// SPI data rate bit on SPCR register andSPSR register (SPI State Register)
-	// SPR1 and SPR2 (SPI Clock Rate Select) bits
-	// Les bits SPR configurent la fréquence du signal d'horloge. Quand l'esclave lit l’horloge d’une broche d’entrée, les bits SPR n’ont aucun effet sur l’esclave. La fréquence de l'horloge SPI est liée à la fréquence de l'oscillateur AVR. Plus le signal d'horloge SPI est rapide, plus le transfert de données sera rapide. vous devez respecter la fréquence d'horloge maximale spécifiée par l'esclave. le Le tableau suivant résume la relation entre la fréquence SCK et les bits SPR:
-	// SPR1 	SPR0 	SCK frequency
-	// 0 		0 		fosc/4
-	// 0 		1 		fosc/16
-	// 1 		0 		fosc/64
-	// 1 		1 		fosc/128
-	w.spi.SPCR.ClearBits(avr.SPCR_SPR0)
-	w.spi.SPCR.ClearBits(avr.SPCR_SPR1)
-	// select MOST Signifiant Bit first
-	w.spi.SPCR.ClearBits(avr.SPCR_DORD)
-	// SPI state (SPSR) to zero
-	w.spi.SPSR.Set(0)
+// NewWithMemory inits a W5100 chip with a custom sharing
+// of the Tx/Rx memory among the sockets (see SetMemorySizes)
+func NewWithMemory(bus Bus, tx, rx MemorySizes) (*W5100, error) {
+	w := New(bus)
+	if err := w.SetMemorySizes(tx, rx); err != nil {
+		return nil, err
+	}
+	return w, nil
 }
 
 // In SPI Mode, W5100 operates in "unit of 32-bit stream".
@@ -67,12 +39,18 @@ func (w *W5100) ConfigureSPI() {
 // 	- 2 bytes Address Field,
 // 	- 1 byte data Field.
 func (w *W5100) write(addr uint16, data uint8) {
-	w.spi.SS.Low()
-	w.spi.Transfer(WRITE)
-	w.spi.Transfer(uint8(addr >> 8))
-	w.spi.Transfer(uint8(addr & 0xFF))
-	w.spi.Transfer(data)
-	w.spi.SS.High()
+	w.bus.Select()
+	w.bus.Transfer(WRITE)
+	w.bus.Transfer(uint8(addr >> 8))
+	w.bus.Transfer(uint8(addr & 0xFF))
+	w.bus.Transfer(data)
+	w.bus.Deselect()
+}
+
+// write16 writes a 2-bytes register (big endian)
+func (w *W5100) write16(addr uint16, data uint16) {
+	w.write(addr, uint8(data>>8))
+	w.write(addr+1, uint8(data&0xFF))
 }
 
 // writeBuffer write several bytes
@@ -89,24 +67,47 @@ func (w *W5100) writeBuffer(addr uint16, buffer []uint8) {
 // 	- 2 bytes Address Field,
 // 	- 1 byte data Field.
 func (w *W5100) read(addr uint16) uint8 {
-	w.spi.SS.Low()
-	w.spi.Transfer(READ)
-	w.spi.Transfer(uint8(addr >> 8))
-	w.spi.Transfer(uint8(addr & 0xFF))
-	data := w.spi.Transfer(0)
-	w.spi.SS.High()
+	w.bus.Select()
+	w.bus.Transfer(READ)
+	w.bus.Transfer(uint8(addr >> 8))
+	w.bus.Transfer(uint8(addr & 0xFF))
+	data := w.bus.Transfer(0)
+	w.bus.Deselect()
 	return data
 }
 
+// read16 reads a 2-bytes register (big endian)
+func (w *W5100) read16(addr uint16) uint16 {
+	return uint16(w.read(addr))<<8 | uint16(w.read(addr+1))
+}
+
+// readStable reads a 16-bit register updated by the chip (which may
+// change between the reads of its two bytes) until two reads agree.
+// It returns ErrTimeout if the value never settles.
+func (w *W5100) readStable(addr uint16) (uint16, error) {
+	for i := 0; i < maxPolls; i++ {
+		val := w.read16(addr)
+		if val == 0 || w.read16(addr) == val {
+			return val, nil
+		}
+	}
+	return 0, ErrTimeout
+}
+
 // readBuffer reads a register
 func (w *W5100) readBuffer(addr uint16, size uint16) []uint8 {
 	buffer := make([]uint8, size)
-	var i uint16
-	for i = 0; i < size; i++ {
+	w.readInto(addr, buffer)
+	return buffer
+}
+
+// readInto fills the buffer with the bytes stored from addr
+// (readBuffer without allocation)
+func (w *W5100) readInto(addr uint16, buffer []uint8) {
+	for i := range buffer {
 		buffer[i] = w.read(addr)
 		addr++
 	}
-	return buffer
 }
 
 // GetIPAddress returns the internal IP address
@@ -114,14 +115,22 @@ func (w *W5100) GetIPAddress() []uint8 {
 	return w.readBuffer(SIPR, 4)
 }
 
-// SetIPAddress defines the internal IP address
-func (w *W5100) SetIPAddress(ip []byte) {
-	w.writeBuffer(SIPR, ip[:4])
+// SetIPAddress defines the internal IP address (4 bytes)
+func (w *W5100) SetIPAddress(ip []byte) error {
+	if len(ip) != 4 {
+		return ErrInvalidAddress
+	}
+	w.writeBuffer(SIPR, ip)
+	return nil
 }
 
-// SetMACAddress defines the internal MAC address
-func (w *W5100) SetMACAddress(mac []uint8) {
+// SetMACAddress defines the internal MAC address (6 bytes)
+func (w *W5100) SetMACAddress(mac []uint8) error {
+	if len(mac) != 6 {
+		return ErrInvalidMAC
+	}
 	w.writeBuffer(SHAR, mac)
+	return nil
 }
 
 // GetMACAddress returns the internal MAC address
@@ -134,42 +143,91 @@ func (w *W5100) GetGatewayIP() []uint8 {
 	return w.readBuffer(GWR, 4)
 }
 
-// SetGatewayIP sets the IP address of the gateway
-func (w *W5100) SetGatewayIP(gw []uint8) {
-	w.writeBuffer(GWR, gw[:4])
+// SetGatewayIP sets the IP address of the gateway (4 bytes)
+func (w *W5100) SetGatewayIP(gw []uint8) error {
+	if len(gw) != 4 {
+		return ErrInvalidAddress
+	}
+	w.writeBuffer(GWR, gw)
+	return nil
 }
 
 // GetSubnetMask returns the subnet mask
-func (w *W5100) GetSubnetMask() uint8 {
-	return w.read(SUBR)
+func (w *W5100) GetSubnetMask() []uint8 {
+	return w.readBuffer(SUBR, 4)
 }
 
-// SetSubnetMask defines the subnet mask
-func (w *W5100) SetSubnetMask(m uint8) {
-	w.write(SUBR, m)
+// SetSubnetMask defines the subnet mask (4 bytes of contiguous
+// leading ones)
+func (w *W5100) SetSubnetMask(m []uint8) error {
+	if _, err := maskBits(m); err != nil {
+		return err
+	}
+	w.writeBuffer(SUBR, m)
+	return nil
 }
 
-// initSocket prepares a socket given its id
+// SetRetryTime sets the TCP/ARP retransmission timeout (RTR).
+// The chip counts in units of 100us (up to 6.5535s).
+func (w *W5100) SetRetryTime(d time.Duration) {
+	units := d / (100 * time.Microsecond)
+	if units > 0xFFFF {
+		units = 0xFFFF
+	}
+	w.write16(RTR, uint16(units))
+}
+
+// GetRetryTime returns the retransmission timeout (RTR)
+func (w *W5100) GetRetryTime() time.Duration {
+	return time.Duration(w.read16(RTR)) * 100 * time.Microsecond
+}
+
+// SetRetryCount sets the number of retransmissions (RCR)
+// before the TIMEOUT interrupt is raised
+func (w *W5100) SetRetryCount(n uint8) {
+	w.write(RCR, n)
+}
+
+// GetRetryCount returns the number of retransmissions (RCR)
+func (w *W5100) GetRetryCount() uint8 {
+	return w.read(RCR)
+}
+
+// initSocket prepares a new handle of the slot given its id, it
+// owns the slot from now on (the previous handle, if any, is stale)
 func (w *W5100) initSocket(id uint8) *Socket {
 	if id >= MaxSockNum {
 		return nil
 	}
-	s := &Socket{uint8: id,
-		wiznet: w,
-		sBase:  TxBufBase + SSIZE*uint16(id),
-		rBase:  RxBufBase + RSIZE*uint16(id)}
-	s.Close()
+	s := &Socket{uint8: id, wiznet: w}
+	s.computeBases()
+	w.sockets[id] = s
+	s.reset()
 	return s
 }
 
-// Socket creates a new socket
+// Socket creates a new socket on the given slot. The slot must not be
+// owned by another socket (see Close), use Open to get a free slot.
 func (w *W5100) Socket(slot uint8, proto uint8, port uint16, flag uint8) (*Socket, error) {
 	if slot >= MaxSockNum {
-		return nil, errors.New("Socket number is greater than the maximum number of sockets")
+		return nil, ErrInvalidSocket
 	}
 
 	if proto != Mode.TCP && proto != Mode.UDP && proto != Mode.IPRAW && proto != Mode.MACRAW && proto != Mode.PPPOE {
-		return nil, errors.New("Bad protocol")
+		return nil, ErrBadProtocol
+	}
+
+	if w.sockets[slot] != nil {
+		return nil, ErrSocketBusy
+	}
+	return w.open(slot, proto, port, flag)
+}
+
+// open creates a new socket on the slot, whether it is owned or not
+// (the handle of the previous owner becomes stale)
+func (w *W5100) open(slot uint8, proto uint8, port uint16, flag uint8) (*Socket, error) {
+	if w.txSizes[slot] == 0 || w.rxSizes[slot] == 0 {
+		return nil, ErrNoMemory
 	}
 
 	// first close the socket
@@ -184,9 +242,78 @@ func (w *W5100) Socket(slot uint8, proto uint8, port uint16, flag uint8) (*Socke
 	// write the port
 	socket.write16(SocketRegister.PORT, port)
 	// now open the socket
-	socket.exec(Command.OPEN)
+	if err := socket.exec(Command.OPEN); err != nil {
+		socket.Close()
+		return nil, err
+	}
 	return socket, nil
+}
 
+// Open creates a new socket on a free slot, i.e. a slot which
+// is not owned and whose socket is CLOSED. MACRAW and PPPoE
+// sockets can only use slot 0. The slot is released on Close.
+func (w *W5100) Open(proto uint8, port uint16, flag uint8) (*Socket, error) {
+	slot, err := w.freeSlot(proto)
+	if err != nil {
+		return nil, err
+	}
+	return w.Socket(slot, proto, port, flag)
+}
+
+// OpenRaw creates a new socket in IPRAW mode on a free slot. The
+// protocol (see IPProto) is written in SnPROTO before opening it.
+func (w *W5100) OpenRaw(proto uint8) (*Socket, error) {
+	slot, err := w.freeSlot(Mode.IPRAW)
+	if err != nil {
+		return nil, err
+	}
+	if w.txSizes[slot] == 0 || w.rxSizes[slot] == 0 {
+		return nil, ErrNoMemory
+	}
+
+	socket := w.initSocket(slot)
+	socket.write(SocketRegister.MR, Mode.IPRAW)
+	socket.write(SocketRegister.PROTO, proto)
+	if err := socket.exec(Command.OPEN); err != nil {
+		socket.Close()
+		return nil, err
+	}
+	return socket, nil
+}
+
+// freeSlot returns the first slot available for the protocol
+func (w *W5100) freeSlot(proto uint8) (uint8, error) {
+	slots := uint8(MaxSockNum)
+	if proto == Mode.MACRAW || proto == Mode.PPPOE {
+		slots = 1
+	}
+	for slot := uint8(0); slot < slots; slot++ {
+		if w.isFree(slot) {
+			return slot, nil
+		}
+	}
+	return 0, ErrNoFreeSocket
+}
+
+// isFree tells whether the slot is neither owned nor open
+// (and has some memory)
+func (w *W5100) isFree(slot uint8) bool {
+	if w.sockets[slot] != nil || w.txSizes[slot] == 0 || w.rxSizes[slot] == 0 {
+		return false
+	}
+	addr := CH_BASE + uint16(slot)*CH_SIZE + SocketRegister.SR
+	return w.read(addr) == Status.CLOSED
+}
+
+// FreeSockets returns the number of slots that can be given by Open
+func (w *W5100) FreeSockets() int {
+	var n int
+	for slot := uint8(0); slot < MaxSockNum; slot++ {
+		if w.isFree(slot) {
+			n++
+		}
+	}
+	return n
 }
 
 func main() {}
@@ -0,0 +1,27 @@
+//go:build avr
+
+package w5100
+
+// Init inits the W5100 chip through the default AVR SPI
+// (pins D10 to D13 of the Uno)
+func Init() *W5100 {
+	spi := DefaultSPI()
+	spi.Configure()
+	return New(spi)
+}
+
+// ConfigureSPI sets the SPI in "Begin" mode. It only
+// applies when the chip is driven by the AVR SPI (see SPI.Configure)
+func (w *W5100) ConfigureSPI() {
+	if spi, ok := w.bus.(*SPI); ok {
+		spi.Configure()
+	}
+}
+
+// InitWithMemory inits the W5100 chip through the default AVR SPI
+// with a custom sharing of the Tx/Rx memory (see SetMemorySizes)
+func InitWithMemory(tx, rx MemorySizes) (*W5100, error) {
+	spi := DefaultSPI()
+	spi.Configure()
+	return NewWithMemory(spi, tx, rx)
+}